@@ -8,8 +8,20 @@ import (
 	"strings"
 )
 
-func normalizeArgumentName(arg string) string {
-	name := strings.Replace(strings.TrimPrefix(strings.ToLower(arg), "-"), "-", "_", -1)
+// Transforms an argument or environment variable name into a key name, lower case
+// (or snake_case with Options.AutoKeys) with dashes as underscores. Unless o has a
+// hierarchical KeyScheme (such as DottedScheme) key names end in an index, "_0" if the name has none.
+func (o Options) normalizeArgumentName(arg string) string {
+	name := strings.TrimLeft(arg, "-")
+	if o.AutoKeys {
+		name = snakeCase(name)
+	}
+	name = strings.Replace(strings.ToLower(name), "-", "_", -1)
+	switch o.scheme().(type) {
+	case nil, PathScheme:
+	default:
+		return name
+	}
 	pos := strings.LastIndex(name, "_")
 	if pos == -1 {
 		return fmt.Sprintf("%s_0", name)
@@ -25,6 +37,12 @@ func normalizeArgumentName(arg string) string {
 // Parse command-line arguments into the key/value store.
 // Note that argument names may be transformed.
 func ParseArgs(kv Setter) error {
+	return Options{}.ParseArgs(kv)
+}
+
+// ParseArgs is like the package-level ParseArgs but naming keys with the scheme of o,
+// e.g. "--servers.1.host" with DottedScheme.
+func (o Options) ParseArgs(kv Setter) error {
 	for i := 1; i < len(os.Args); i++ {
 		if !strings.HasPrefix(os.Args[i], "-") {
 			return errors.New(fmt.Sprintf("invalid argument: \"%s\"", os.Args[i]))
@@ -36,11 +54,11 @@ func ParseArgs(kv Setter) error {
 			if strings.HasPrefix(os.Args[i+1], "-") {
 				return errors.New(fmt.Sprintf("value following argument cannot start with \"-\": %s", os.Args[i+1]))
 			}
-			kv.Set(normalizeArgumentName(os.Args[i]), os.Args[i+1])
+			kv.Set(o.normalizeArgumentName(os.Args[i]), os.Args[i+1])
 			i++
 		} else {
 			split := strings.SplitN(os.Args[i], "=", 2)
-			kv.Set(normalizeArgumentName(split[0]), split[1])
+			kv.Set(o.normalizeArgumentName(split[0]), split[1])
 		}
 	}
 
@@ -50,11 +68,22 @@ func ParseArgs(kv Setter) error {
 // Parse environment variables starting with "CFG_" into the key/value store.
 // Note that environment variable names may be transformed.
 func ParseEnv(kv Setter) {
+	Options{}.ParseEnv(kv)
+}
+
+// ParseEnv is like the package-level ParseEnv but naming keys with the scheme of o.
+// With DottedScheme double underscores separate the parts of variable names,
+// e.g. "CFG_SERVERS__1__HOST" for "servers.1.host".
+func (o Options) ParseEnv(kv Setter) {
 	for _, arg := range os.Environ() {
 		if !strings.HasPrefix(arg, "CFG_") {
 			continue
 		}
 		split := strings.SplitN(arg[4:], "=", 2)
-		kv.Set(normalizeArgumentName(split[0]), split[1])
+		name := split[0]
+		if d, ok := o.scheme().(DottedScheme); ok {
+			name = strings.Replace(name, "__", d.separator(), -1)
+		}
+		kv.Set(o.normalizeArgumentName(name), split[1])
 	}
 }
@@ -0,0 +1,113 @@
+package kvconfig
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSnakeCase(t *testing.T) {
+	testTable := map[string]string{
+		"Port":         "port",
+		"TLSCert":      "tls_cert",
+		"MaxIdleConns": "max_idle_conns",
+		"UserID":       "user_id",
+		"HTTP2Port":    "http2_port",
+		"ID":           "id",
+		"TLS_CERT":     "tls_cert",
+		"log-level":    "log-level",
+	}
+	for name, tV := range testTable {
+		if v := snakeCase(name); v != tV {
+			t.Errorf("snakeCase(%q) = %q; wanted %q", name, v, tV)
+		}
+	}
+}
+
+func TestAutoKeys(t *testing.T) {
+	type TestTLS struct {
+		TLSCert string
+		KeyFile string `kvconfig:"key"`
+	}
+
+	type TestStruct struct {
+		TestTLS
+		ListenAddr string
+		MaxConns   int    `kvconfig:",default=10"`
+		Internal   string `kvconfig:"-"`
+		Upstreams  []string
+	}
+
+	ts := TestStruct{
+		TestTLS:    TestTLS{"a.crt", "a.key"},
+		ListenAddr: ":443",
+		MaxConns:   5,
+		Internal:   "x",
+		Upstreams:  []string{"b", "c"},
+	}
+
+	testTable := []struct {
+		o    Options
+		keys MapStrStr
+	}{
+		{Options{AutoKeys: true}, MapStrStr{
+			"tls_cert_0": "a.crt", "key_0": "a.key", "listen_addr_0": ":443", "max_conns_0": "5",
+			"upstreams_0": "b", "upstreams_1": "c",
+		}},
+		{Options{AutoKeys: true, Scheme: DottedScheme{}}, MapStrStr{
+			"tls_cert": "a.crt", "key": "a.key", "listen_addr": ":443", "max_conns": "5",
+			"upstreams.0": "b", "upstreams.1": "c",
+		}},
+	}
+
+	for _, tE := range testTable {
+		kv := &MapStrStr{}
+		if err := tE.o.Export(&ts, kv); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if !reflect.DeepEqual(*kv, tE.keys) {
+			t.Errorf("Export() = %v; wanted %v", *kv, tE.keys)
+		}
+
+		var ts2 TestStruct
+		if err := tE.o.Import(kv, &ts2); err != nil {
+			t.Fatalf("Import() error = %v", err)
+		}
+		want := ts
+		want.Internal = ""
+		if !reflect.DeepEqual(ts2, want) {
+			t.Errorf("Import() = %+v; wanted %+v", ts2, want)
+		}
+	}
+
+	// without AutoKeys only tagged fields have keys
+	kv := &MapStrStr{}
+	if err := Export(&ts, kv); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if _, ok := kv.Lookup("listen_addr_0"); ok || kv.Get("key_0") != "a.key" {
+		t.Errorf("Export() = %v; wanted only tagged fields", *kv)
+	}
+}
+
+func TestParseArgsEnvAutoKeys(t *testing.T) {
+	args := os.Args
+	defer func() { os.Args = args }()
+
+	os.Args = []string{"test", "--TLSCert", "a.crt", "--max-conns=5"}
+	os.Setenv("CFG_LISTEN_ADDR", ":443")
+	defer os.Unsetenv("CFG_LISTEN_ADDR")
+
+	kv := NewMap()
+	o := Options{AutoKeys: true}
+	if err := o.ParseArgs(kv); err != nil {
+		t.Fatalf("ParseArgs() error = %v", err)
+	}
+	o.ParseEnv(kv)
+
+	for k, tV := range map[string]string{"tls_cert_0": "a.crt", "max_conns_0": "5", "listen_addr_0": ":443"} {
+		if v, ok := kv.Lookup(k); !ok || v != tV {
+			t.Errorf("kv.Lookup(%q) = %q, %v; wanted %q, true", k, v, ok, tV)
+		}
+	}
+}
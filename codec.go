@@ -0,0 +1,212 @@
+package kvconfig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Codec imports and exports values of a single type, typically one the caller doesn't own.
+type Codec interface {
+	// Import returns the value stored for f, or ErrKeyNotFound if none of its keys are present.
+	Import(kv Getter, f Field) (interface{}, error)
+
+	// Export stores the value v for f.
+	Export(kv Setter, f Field, v interface{}) error
+}
+
+// CodecFuncs adapts a pair of functions to the Codec interface.
+type CodecFuncs struct {
+	ImportFunc func(kv Getter, f Field) (interface{}, error)
+	ExportFunc func(kv Setter, f Field, v interface{}) error
+}
+
+func (c CodecFuncs) Import(kv Getter, f Field) (interface{}, error) {
+	return c.ImportFunc(kv, f)
+}
+
+func (c CodecFuncs) Export(kv Setter, f Field, v interface{}) error {
+	return c.ExportFunc(kv, f, v)
+}
+
+// TextCodec returns a Codec for values stored in a single key using parse and format.
+func TextCodec(parse func(string) (interface{}, error), format func(interface{}) (string, error)) Codec {
+	return CodecFuncs{
+		ImportFunc: func(kv Getter, f Field) (interface{}, error) {
+			str, ok := kv.Lookup(f.Key())
+			if !ok {
+				return nil, ErrKeyNotFound
+			}
+			return parse(str)
+		},
+		ExportFunc: func(kv Setter, f Field, v interface{}) error {
+			str, err := format(v)
+			if err != nil {
+				return err
+			}
+			kv.Set(f.Key(), str)
+			return nil
+		},
+	}
+}
+
+// Registry maps Go types to the Codecs used to import and export them.
+// Codecs take precedence over Marshaler, TextMarshaler and built-in handling of a type.
+type Registry struct {
+	codecs map[reflect.Type]Codec
+	impls  map[reflect.Type]reflect.Type
+}
+
+// DefaultRegistry is used by Import and Export and when Options.Registry is nil.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry returns a Registry holding the default codecs for time.Duration, time.Time,
+// *tls.Certificate, certificates (*x509.Certificate, []*x509.Certificate and *x509.CertPool)
+// and private keys (*rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey, crypto.Signer
+// and crypto.PrivateKey).
+func NewRegistry() *Registry {
+	r := &Registry{}
+	r.Register(time.Duration(0), durationCodec)
+	r.Register(time.Time{}, timeCodec)
+	r.Register((*rsa.PrivateKey)(nil), privateKeyCodec)
+	r.Register((*ecdsa.PrivateKey)(nil), privateKeyCodec)
+	r.Register(ed25519.PrivateKey(nil), privateKeyCodec)
+	r.RegisterType(reflect.TypeOf((*crypto.Signer)(nil)).Elem(), privateKeyCodec)
+	r.RegisterType(reflect.TypeOf((*crypto.PrivateKey)(nil)).Elem(), privateKeyCodec)
+	r.Register((*tls.Certificate)(nil), tlsCertificateCodec)
+	r.Register((*x509.Certificate)(nil), x509CertificateCodec)
+	r.Register([]*x509.Certificate(nil), x509CertificatesCodec)
+	r.Register((*x509.CertPool)(nil), x509CertPoolCodec)
+	return r
+}
+
+// Register sets the Codec for values of the same type as v, replacing any existing one.
+// For pointer types pass a typed nil, e.g. (*big.Int)(nil).
+func (r *Registry) Register(v interface{}, c Codec) {
+	r.RegisterType(reflect.TypeOf(v), c)
+}
+
+// RegisterType sets the Codec for values of type t, replacing any existing one.
+// Use this to register interface types, e.g. reflect.TypeOf((*crypto.Signer)(nil)).Elem().
+func (r *Registry) RegisterType(t reflect.Type, c Codec) {
+	if r.codecs == nil {
+		r.codecs = make(map[reflect.Type]Codec)
+	}
+	r.codecs[t] = c
+}
+
+// Unregister removes the Codec for values of the same type as v.
+func (r *Registry) Unregister(v interface{}) {
+	delete(r.codecs, reflect.TypeOf(v))
+}
+
+// RegisterImpl sets the concrete type imported into nil fields of an interface type,
+// replacing any existing one. iface is a nil pointer to the interface type and impl a
+// value of the concrete type, e.g. RegisterImpl((*Store)(nil), (*FileStore)(nil)).
+// Concrete pointer types are allocated. It panics if impl doesn't implement the interface.
+func (r *Registry) RegisterImpl(iface, impl interface{}) {
+	it := reflect.TypeOf(iface)
+	if it == nil || it.Kind() != reflect.Ptr || it.Elem().Kind() != reflect.Interface {
+		panic(fmt.Sprintf("kvconfig: RegisterImpl of %v, wanted a pointer to an interface", it))
+	}
+	t := reflect.TypeOf(impl)
+	if t == nil || !t.Implements(it.Elem()) {
+		panic(fmt.Sprintf("kvconfig: RegisterImpl of %v, which doesn't implement %v", t, it.Elem()))
+	}
+	if r.impls == nil {
+		r.impls = make(map[reflect.Type]reflect.Type)
+	}
+	r.impls[it.Elem()] = t
+}
+
+// Returns the concrete type registered for the interface type t
+func (r *Registry) impl(t reflect.Type) (reflect.Type, bool) {
+	if r == nil {
+		return nil, false
+	}
+	it, ok := r.impls[t]
+	return it, ok
+}
+
+func (r *Registry) lookup(t reflect.Type) (Codec, bool) {
+	if r == nil || t == nil {
+		return nil, false
+	}
+	c, ok := r.codecs[t]
+	return c, ok
+}
+
+// Checks that a value returned from a Codec can be stored in a value of type t
+func codecValue(i interface{}, t reflect.Type) (reflect.Value, error) {
+	v := reflect.ValueOf(i)
+	if !v.IsValid() {
+		return reflect.Zero(t), nil
+	}
+	if !v.Type().AssignableTo(t) {
+		return reflect.Value{}, fmt.Errorf("codec returned %v, wanted %v", v.Type(), t)
+	}
+	return v, nil
+}
+
+var durationCodec = TextCodec(
+	func(str string) (interface{}, error) {
+		return time.ParseDuration(str)
+	},
+	func(v interface{}) (string, error) {
+		return v.(time.Duration).String(), nil
+	},
+)
+
+var timeCodec = CodecFuncs{
+	ImportFunc: func(kv Getter, f Field) (interface{}, error) {
+		str, ok := kv.Lookup(f.Key())
+		if !ok {
+			return nil, ErrKeyNotFound
+		}
+		return time.Parse(timeLayout(f), str)
+	},
+	ExportFunc: func(kv Setter, f Field, v interface{}) error {
+		kv.Set(f.Key(), v.(time.Time).Format(timeLayout(f)))
+		return nil
+	},
+}
+
+// Named layouts accepted by the "layout" tag option
+var timeLayouts = map[string]string{
+	"ansic":       time.ANSIC,
+	"unixdate":    time.UnixDate,
+	"rubydate":    time.RubyDate,
+	"rfc822":      time.RFC822,
+	"rfc822z":     time.RFC822Z,
+	"rfc850":      time.RFC850,
+	"rfc1123":     time.RFC1123,
+	"rfc1123z":    time.RFC1123Z,
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"kitchen":     time.Kitchen,
+	"stamp":       time.Stamp,
+	"datetime":    time.DateTime,
+	"dateonly":    time.DateOnly,
+	"timeonly":    time.TimeOnly,
+}
+
+// Returns the time layout selected by the "layout" tag option, by default RFC 3339 with
+// any fractional seconds, so that times round-trip exactly.
+// The option may name a layout constant from the time package (e.g. "rfc1123") or be a layout itself.
+func timeLayout(f Field) string {
+	layout, ok := f.Option("layout")
+	if !ok || layout == "" {
+		return time.RFC3339Nano
+	}
+	if named, ok := timeLayouts[strings.ToLower(layout)]; ok {
+		return named
+	}
+	return layout
+}
@@ -0,0 +1,84 @@
+package kvconfig
+
+import (
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRegistryCodecs(t *testing.T) {
+	type TestStruct struct {
+		TestURL      *url.URL      `kvconfig:"test_url"`
+		TestDuration time.Duration `kvconfig:"test_duration"`
+	}
+
+	r := NewRegistry()
+	r.Register((*url.URL)(nil), TextCodec(
+		func(str string) (interface{}, error) {
+			return url.Parse(str)
+		},
+		func(v interface{}) (string, error) {
+			return v.(*url.URL).String(), nil
+		},
+	))
+	// override the default "30s" style durations with seconds
+	r.Register(time.Duration(0), TextCodec(
+		func(str string) (interface{}, error) {
+			secs, err := strconv.Atoi(str)
+			return time.Duration(secs) * time.Second, err
+		},
+		func(v interface{}) (string, error) {
+			return strconv.Itoa(int(v.(time.Duration) / time.Second)), nil
+		},
+	))
+
+	opts := Options{Registry: r}
+
+	testURL, _ := url.Parse("https://example.com/path")
+
+	ts := TestStruct{
+		TestURL:      testURL,
+		TestDuration: 90 * time.Second,
+	}
+
+	kv := NewMap()
+
+	if err := opts.Export(&ts, kv); err != nil {
+		t.Fatalf("Options.Export() error = %v", err)
+	}
+
+	testTable := map[string]string{
+		"test_url_0":      "https://example.com/path",
+		"test_duration_0": "90",
+	}
+
+	for k, tV := range testTable {
+		if v, ok := kv.Lookup(k); ok == false {
+			t.Errorf("kv.Lookup(%q) = _, false; wanted _, true", k)
+		} else if v != tV {
+			t.Errorf("kv.Lookup(%q) = %q, _; wanted %q, _", k, v, tV)
+		}
+	}
+
+	ts2 := TestStruct{}
+
+	if err := opts.Import(kv, &ts2); err != nil {
+		t.Fatalf("Options.Import() error = %v", err)
+	}
+
+	if ts2.TestURL == nil {
+		t.Error("TestStruct.TestURL == nil")
+	} else if ts2.TestURL.String() != testURL.String() {
+		t.Errorf("TestStruct.TestURL = %v; wanted %v", ts2.TestURL, testURL)
+	}
+
+	if ts2.TestDuration != ts.TestDuration {
+		t.Errorf("TestStruct.TestDuration = %v; wanted %v", ts2.TestDuration, ts.TestDuration)
+	}
+
+	if _, ok := DefaultRegistry.lookup(reflect.TypeOf(testURL)); ok {
+		t.Error("DefaultRegistry modified by NewRegistry().Register()")
+	}
+}
@@ -0,0 +1,344 @@
+package kvconfig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Private keys are stored as base64 DER, PKCS #8 unless the "pkcs1" (RSA)
+// or "sec1" (ECDSA) field tag option is given. Any of the three are accepted on import.
+// With the "pem" tag option (or Options.PEM) keys are stored PEM encoded instead.
+var privateKeyCodec = CodecFuncs{
+	ImportFunc: func(kv Getter, f Field) (interface{}, error) {
+		str, ok := kv.Lookup(f.Key())
+		if !ok {
+			return nil, ErrKeyNotFound
+		}
+		return unmarshalPrivateKey(str)
+	},
+	ExportFunc: func(kv Setter, f Field, v interface{}) error {
+		str, err := marshalPrivateKey(v, f)
+		if err != nil {
+			return err
+		}
+		kv.Set(f.Key(), str)
+		return nil
+	},
+}
+
+// Certificates and bundles of certificates are stored in a single key.
+// A *x509.CertPool can't be enumerated so exporting one fails with an UnsupportedTypeError.
+var (
+	x509CertificateCodec = CodecFuncs{
+		ImportFunc: func(kv Getter, f Field) (interface{}, error) {
+			str, ok := kv.Lookup(f.Key())
+			if !ok {
+				return nil, ErrKeyNotFound
+			}
+			certs, _, err := unmarshalCertificates(str)
+			if err != nil {
+				return nil, err
+			}
+			if len(certs) != 1 {
+				return nil, errors.New("expected a single certificate")
+			}
+			return certs[0], nil
+		},
+		ExportFunc: func(kv Setter, f Field, v interface{}) error {
+			kv.Set(f.Key(), marshalCertificates([]*x509.Certificate{v.(*x509.Certificate)}, f))
+			return nil
+		},
+	}
+
+	x509CertificatesCodec = CodecFuncs{
+		ImportFunc: func(kv Getter, f Field) (interface{}, error) {
+			str, ok := kv.Lookup(f.Key())
+			if !ok {
+				return nil, ErrKeyNotFound
+			}
+			certs, _, err := unmarshalCertificates(str)
+			return certs, err
+		},
+		ExportFunc: func(kv Setter, f Field, v interface{}) error {
+			if certs := v.([]*x509.Certificate); len(certs) > 0 {
+				kv.Set(f.Key(), marshalCertificates(certs, f))
+			}
+			return nil
+		},
+	}
+
+	x509CertPoolCodec = CodecFuncs{
+		ImportFunc: func(kv Getter, f Field) (interface{}, error) {
+			str, ok := kv.Lookup(f.Key())
+			if !ok {
+				return nil, ErrKeyNotFound
+			}
+			certs, _, err := unmarshalCertificates(str)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			for _, cert := range certs {
+				pool.AddCert(cert)
+			}
+			return pool, nil
+		},
+		ExportFunc: func(kv Setter, f Field, v interface{}) error {
+			return &UnsupportedTypeError{reflect.TypeOf(v)}
+		},
+	}
+)
+
+var tlsCertificateCodec = CodecFuncs{
+	ImportFunc: func(kv Getter, f Field) (interface{}, error) {
+		return importTLSCertificate(kv, f)
+	},
+	ExportFunc: func(kv Setter, f Field, v interface{}) error {
+		return exportTLSCertificate(kv, f, v.(*tls.Certificate))
+	},
+}
+
+// Reports whether certificates and keys for f should be PEM encoded
+func (f Field) pem() bool {
+	_, ok := f.Option("pem")
+	return ok || (f.o != nil && f.o.PEM)
+}
+
+// Decodes a base64 DER value, or every block of a PEM value.
+// PEM blocks must be one of blockTypes.
+func decodeDER(s string, blockTypes ...string) ([][]byte, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "-----BEGIN") {
+		der, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{der}, nil
+	}
+
+	// PEM pasted into a single line with escaped newlines
+	if !strings.Contains(s, "\n") {
+		s = strings.Replace(s, `\n`, "\n", -1)
+	}
+
+	var ders [][]byte
+	rest := []byte(s)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if !containsString(blockTypes, block.Type) {
+			return nil, fmt.Errorf("unexpected PEM block type %q", block.Type)
+		}
+		ders = append(ders, block.Bytes)
+	}
+	if len(ders) == 0 || len(strings.TrimSpace(string(rest))) > 0 {
+		return nil, errors.New("invalid PEM data")
+	}
+	return ders, nil
+}
+
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Encodes der as base64, or as a PEM block of blockType if pemEncode is set
+func encodeDER(der []byte, blockType string, pemEncode bool) string {
+	if pemEncode {
+		return string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}))
+	}
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func unmarshalPrivateKey(s string) (interface{}, error) {
+	ders, err := decodeDER(s, "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	if len(ders) != 1 {
+		return nil, errors.New("expected a single private key")
+	}
+	return parsePrivateKey(ders[0])
+}
+
+// Parses a PKCS #8, PKCS #1 or SEC 1 DER private key, like crypto/tls does
+func parsePrivateKey(der []byte) (interface{}, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("failed to parse private key as PKCS #8, PKCS #1 or SEC 1")
+}
+
+func marshalPrivateKey(pk interface{}, f Field) (string, error) {
+	var der []byte
+	var err error
+	blockType := "PRIVATE KEY"
+	_, pkcs1 := f.Option("pkcs1")
+	_, sec1 := f.Option("sec1")
+	switch k := pk.(type) {
+	case *rsa.PrivateKey:
+		if pkcs1 {
+			der, blockType = x509.MarshalPKCS1PrivateKey(k), "RSA PRIVATE KEY"
+			break
+		}
+		der, err = x509.MarshalPKCS8PrivateKey(k)
+	case *ecdsa.PrivateKey:
+		if sec1 {
+			der, err = x509.MarshalECPrivateKey(k)
+			blockType = "EC PRIVATE KEY"
+			break
+		}
+		der, err = x509.MarshalPKCS8PrivateKey(k)
+	default:
+		der, err = x509.MarshalPKCS8PrivateKey(k)
+	}
+	if err != nil {
+		return "", err
+	}
+	return encodeDER(der, blockType, f.pem()), nil
+}
+
+// Key holding the i'th (zero-based) certificate of a chain
+func tlsCertKey(f Field, i int) string {
+	if i < 1 {
+		return f.SubKey("cert")
+	}
+	return f.SubKey(fmt.Sprintf("cert%d", i+1))
+}
+
+func importTLSCertificate(kv Getter, f Field) (*tls.Certificate, error) {
+	_, certOk := kv.Lookup(tlsCertKey(f, 0))
+	keyStr, keyOk := kv.Lookup(f.SubKey("pk"))
+
+	if !keyOk || !certOk {
+		return nil, ErrKeyNotFound
+	}
+
+	tC := tls.Certificate{}
+
+	for i := 0; ; i++ {
+		keyName := tlsCertKey(f, i)
+
+		if certStr, ok := kv.Lookup(keyName); ok {
+			certs, ders, err := unmarshalCertificates(certStr)
+			if err != nil {
+				return nil, &KeyError{Key: keyName, Value: certStr, Err: err}
+			}
+			if tC.Leaf == nil {
+				tC.Leaf = certs[0]
+			}
+			tC.Certificate = append(tC.Certificate, ders...)
+		} else {
+			break
+		}
+	}
+
+	var err error
+	tC.PrivateKey, err = unmarshalPrivateKey(keyStr)
+	if err == nil {
+		err = checkKeyPair(tC.Leaf, tC.PrivateKey)
+	}
+	if err != nil {
+		return nil, &KeyError{Key: f.SubKey("pk"), Value: keyStr, Err: err}
+	}
+
+	return &tC, nil
+}
+
+// Checks that key is the private key for cert's public key, like tls.X509KeyPair
+func checkKeyPair(cert *x509.Certificate, key crypto.PrivateKey) error {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return errors.New("private key does not implement crypto.Signer")
+	}
+	pub, ok := cert.PublicKey.(interface {
+		Equal(crypto.PublicKey) bool
+	})
+	if !ok {
+		return fmt.Errorf("unknown public key type %T", cert.PublicKey)
+	}
+	if !pub.Equal(signer.Public()) {
+		return errors.New("private key does not match public key")
+	}
+	return nil
+}
+
+// Parses one base64 DER or any number of PEM certificates
+func unmarshalCertificates(s string) ([]*x509.Certificate, [][]byte, error) {
+	ders, err := decodeDER(s, "CERTIFICATE")
+	if err != nil {
+		return nil, nil, err
+	}
+	certs := make([]*x509.Certificate, len(ders))
+	for i, der := range ders {
+		if certs[i], err = x509.ParseCertificate(der); err != nil {
+			return nil, nil, err
+		}
+	}
+	return certs, ders, nil
+}
+
+// Bundles of more than one certificate are always PEM encoded
+func marshalCertificates(certs []*x509.Certificate, f Field) string {
+	var str string
+	for _, cert := range certs {
+		str += encodeDER(cert.Raw, "CERTIFICATE", f.pem() || len(certs) > 1)
+	}
+	return str
+}
+
+func exportTLSCertificate(kv Setter, f Field, tlsCert *tls.Certificate) error {
+	if tlsCert == nil {
+		return nil
+	}
+
+	tC := *tlsCert
+
+	if f.pem() {
+		// the whole chain, in order, in a single key
+		var chain string
+		for _, cert := range tC.Certificate {
+			chain += encodeDER(cert, "CERTIFICATE", true)
+		}
+		kv.Set(tlsCertKey(f, 0), chain)
+	} else {
+		for i := 0; i < len(tC.Certificate); i++ {
+			if len(tC.Certificate[i]) > 0 {
+				certStr := base64.StdEncoding.EncodeToString(tC.Certificate[i])
+				kv.Set(tlsCertKey(f, i), certStr)
+			}
+		}
+	}
+
+	if tC.PrivateKey != nil {
+		keyStr, err := marshalPrivateKey(tC.PrivateKey, f)
+		if err != nil {
+			return &KeyError{Key: f.SubKey("pk"), Err: err}
+		}
+		kv.Set(f.SubKey("pk"), keyStr)
+	}
+
+	return nil
+}
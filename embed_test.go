@@ -0,0 +1,188 @@
+package kvconfig
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testBase struct {
+	Name string `kvconfig:"name"`
+}
+
+func TestEmbeddedRoundTrip(t *testing.T) {
+	type TestTLSOptions struct {
+		CertFile string `kvconfig:"cert_file"`
+		KeyFile  string `kvconfig:"key_file"`
+	}
+
+	type TestServer struct {
+		testBase
+		*TestTLSOptions
+		Port int `kvconfig:"port"`
+	}
+
+	type TestProxy struct {
+		TestTLSOptions `kvconfig:"upstream"`
+		Port           int `kvconfig:"proxy_port"`
+	}
+
+	type TestStruct struct {
+		Servers []TestServer
+		Proxy   TestProxy
+	}
+
+	ts := TestStruct{
+		Servers: []TestServer{
+			{testBase{"a"}, &TestTLSOptions{"a.crt", "a.key"}, 443},
+			{testBase{"b"}, nil, 80},
+		},
+		Proxy: TestProxy{TestTLSOptions{"p.crt", "p.key"}, 8443},
+	}
+
+	testTable := map[string]string{
+		"name_0":               "a",
+		"cert_file_0":          "a.crt",
+		"key_file_0":           "a.key",
+		"port_0":               "443",
+		"name_1":               "b",
+		"port_1":               "80",
+		"upstream_cert_file_0": "p.crt",
+		"upstream_key_file_0":  "p.key",
+		"proxy_port_0":         "8443",
+	}
+
+	for _, o := range []Options{{}, {PathKeys: true}} {
+		kv := NewMap()
+
+		if err := o.Export(&ts, kv); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+
+		for k, tV := range testTable {
+			if v, ok := kv.Lookup(k); ok == false {
+				t.Errorf("kv.Lookup(%q) = _, false; wanted _, true", k)
+			} else if v != tV {
+				t.Errorf("kv.Lookup(%q) = %q, _; wanted %q, _", k, v, tV)
+			}
+		}
+
+		if len(*kv) != len(testTable) {
+			t.Errorf("len(kv) = %d; wanted %d: %v", len(*kv), len(testTable), *kv)
+		}
+
+		ts2 := TestStruct{}
+
+		if err := o.Import(kv, &ts2); err != nil {
+			t.Fatalf("Import() error = %v", err)
+		}
+
+		if !reflect.DeepEqual(ts2, ts) {
+			t.Errorf("Import() = %+v; wanted %+v", ts2, ts)
+		}
+	}
+
+	type TestUnexportedPtr struct {
+		*testBase
+	}
+
+	errs, ok := Import(&MapStrStr{"name_0": "a"}, &TestUnexportedPtr{}).(Errors)
+	if !ok || len(errs) != 1 || errs[0].Field != "TestUnexportedPtr.testBase" {
+		t.Errorf("Import() error = %v; wanted error for embedded pointer to unexported struct", errs)
+	}
+}
+
+func TestEmbeddedShadowing(t *testing.T) {
+	type TestBase struct {
+		Host string `kvconfig:"host"`
+		Port int    `kvconfig:"port"`
+	}
+
+	type TestOther struct {
+		Port int    `kvconfig:"port"`
+		User string `kvconfig:"user"`
+	}
+
+	// Host hides TestBase.Host though declared first, and the ports of
+	// TestBase and TestOther hide each other
+	type TestStruct struct {
+		Host string `kvconfig:"host"`
+		TestBase
+		TestOther
+	}
+
+	ts := TestStruct{Host: "outer", TestBase: TestBase{"inner", 80}, TestOther: TestOther{8080, "u"}}
+	kv := NewMap()
+	if err := Export(&ts, kv); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if want := (MapStrStr{"host_0": "outer", "user_0": "u"}); !reflect.DeepEqual(*kv, want) {
+		t.Errorf("Export() = %v; wanted %v", *kv, want)
+	}
+
+	kv.Set("port_0", "443")
+	ts2 := TestStruct{}
+	if err := Import(kv, &ts2); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if want := (TestStruct{Host: "outer", TestOther: TestOther{User: "u"}}); !reflect.DeepEqual(ts2, want) {
+		t.Errorf("Import() = %+v; wanted %+v", ts2, want)
+	}
+}
+
+func TestEmbeddedSharedBase(t *testing.T) {
+	type TestTLSOpts struct {
+		Cert string `kvconfig:"cert"`
+	}
+
+	type TestHTTPSrv struct {
+		TestTLSOpts
+		Port int `kvconfig:"http_port"`
+	}
+
+	type TestGRPCSrv struct {
+		*TestTLSOpts
+		Port int `kvconfig:"grpc_port"`
+	}
+
+	type TestStruct struct {
+		HTTP []TestHTTPSrv
+		GRPC []TestGRPCSrv
+	}
+
+	ts := TestStruct{
+		HTTP: []TestHTTPSrv{{TestTLSOpts{"h0"}, 80}, {TestTLSOpts{"h1"}, 81}},
+		GRPC: []TestGRPCSrv{{&TestTLSOpts{"g0"}, 90}},
+	}
+
+	kv := NewMap()
+	if err := Export(&ts, kv); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	// the embedded structures are counted by their own type rather than by the servers
+	testTable := MapStrStr{
+		"cert_0":      "h0",
+		"http_port_0": "80",
+		"cert_1":      "h1",
+		"http_port_1": "81",
+		"cert_2":      "g0",
+		"grpc_port_0": "90",
+	}
+	if !reflect.DeepEqual(*kv, testTable) {
+		t.Errorf("Export() = %v; wanted %v", *kv, testTable)
+	}
+
+	ts2 := TestStruct{}
+	if err := Import(kv, &ts2); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if !reflect.DeepEqual(ts2, ts) {
+		t.Errorf("Import() = %+v; wanted %+v", ts2, ts)
+	}
+
+	// path keys of elements of untagged slices only differ by index
+	errs, ok := Options{PathKeys: true}.Export(&ts, NewMap()).(Errors)
+	if !ok || len(errs) != 1 || errs[0].Key != "cert_0" || errs[0].Err != ErrDuplicateKey {
+		t.Errorf("Export() error = %v; wanted ErrDuplicateKey for key %q", errs, "cert_0")
+	}
+}
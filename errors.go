@@ -0,0 +1,98 @@
+package kvconfig
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	// ErrKeyNotFound is returned by an Unmarshaler or Codec when none of its keys are present.
+	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrRequired is the cause of a KeyError for an absent key of a field with the "required" tag option.
+	ErrRequired = errors.New("required key not found")
+
+	// ErrArrayOverflow is the cause of a KeyError for a key of an element past the end of an array field.
+	ErrArrayOverflow = errors.New("more elements than the array holds")
+
+	// ErrDuplicateKey is the cause of a KeyError for a key set for more than one field in an
+	// export, e.g. for same-tagged fields of structures of different types counted alike,
+	// whose later values would otherwise overwrite the first.
+	ErrDuplicateKey = errors.New("key already set for another field")
+)
+
+// KeyError describes a key whose value could not be imported into or exported from a struct field.
+type KeyError struct {
+	Key   string // key name in the key/value store
+	Field string // Go path of the field (e.g. "Config.Servers[1].Port")
+	Value string // raw value from the key/value store, if any
+	Err   error  // underlying cause
+}
+
+func (e *KeyError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("%s: %v", e.Field, e.Err)
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("key %q: %v", e.Key, e.Err)
+	}
+	return fmt.Sprintf("key %q (%s): %v", e.Key, e.Field, e.Err)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// UnsupportedTypeError is the cause of a KeyError for a tagged field whose type can't be
+// imported or exported, e.g. a channel, or a nil interface with no concrete type registered.
+// It is only reported on import when the field's key is present, and on export when the
+// value isn't nil.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("unsupported type %v", e.Type)
+}
+
+// InvalidTargetError describes an invalid structure passed to Import, which must be
+// a non-nil pointer, or to Export, which must not be nil.
+type InvalidTargetError struct {
+	Op   string // "Import" or "Export"
+	Type reflect.Type
+}
+
+func (e *InvalidTargetError) Error() string {
+	if e.Type == nil {
+		return fmt.Sprintf("kvconfig: %s(nil)", e.Op)
+	}
+	if e.Type.Kind() != reflect.Ptr {
+		return fmt.Sprintf("kvconfig: %s(non-pointer %v)", e.Op, e.Type)
+	}
+	return fmt.Sprintf("kvconfig: %s(nil %v)", e.Op, e.Type)
+}
+
+// Errors is the list of KeyErrors collected while walking a structure.
+// Import continues past bad keys so that every offending key can be reported at once.
+type Errors []*KeyError
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	msgs := make([]string, len(e))
+	for i, ke := range e {
+		msgs[i] = ke.Error()
+	}
+	return fmt.Sprintf("%d errors:\n\t%s", len(e), strings.Join(msgs, "\n\t"))
+}
+
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, ke := range e {
+		errs[i] = ke
+	}
+	return errs
+}
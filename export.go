@@ -1,83 +1,299 @@
 package kvconfig
 
 import (
-	"reflect"
-	"strconv"
-
-	"crypto/rsa"
-	"crypto/tls"
-	"crypto/x509"
-	"encoding/base64"
+	"encoding"
+	"errors"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 )
 
 type exportState struct {
-	structCounter
-	depth int
+	walkState
+}
+
+// Setter underlying the others during an export, keeping the first value of a key
+// set more than once and reporting the later ones
+type exportSetter struct {
+	Setter
+	s   *walkState
+	set map[string]bool
+}
+
+func (g *exportSetter) Set(k, v string) {
+	if g.set[k] {
+		g.s.addError(k, v, ErrDuplicateKey)
+		return
+	}
+	g.set[k] = true
+	g.Setter.Set(k, v)
 }
 
 // Uses reflection to walk the structure i and set values in the key/value interface kv.
+// Values that cannot be marshaled are skipped and reported together in an Errors value.
+// Fields with the "omitempty" tag option are skipped if empty: zero, or of zero length.
+// Fields with the "file" tag option are always skipped, as their values come from files.
+// i must not be nil, otherwise an InvalidTargetError is returned.
 func Export(i interface{}, kv Setter) error {
-	s := exportState{}
-	s.structCounter = make(structCounter)
-	return exportWalk(reflect.ValueOf(i), nil, kv, &s)
+	return Options{}.Export(i, kv)
+}
+
+// Export is like the package-level Export but using the options in o.
+func (o Options) Export(i interface{}, kv Setter) error {
+	v := reflect.ValueOf(i)
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return &InvalidTargetError{Op: "Export", Type: reflect.TypeOf(i)}
+	}
+	if o.Baseline != nil {
+		return o.exportChanges(i, kv)
+	}
+	s := exportState{newWalkState(o, i)}
+	kv = &exportSetter{kv, &s.walkState, make(map[string]bool)}
+	if err := exportWalk(v, nil, kv, &s); err != nil {
+		return err
+	}
+	return s.err()
+}
+
+var errNotDeleter = errors.New("kvconfig: ExportReplace requires a key/value store implementing Getter and Deleter")
+
+// ExportReplace is like Export but also deletes the keys of kv that importing a structure
+// of i's type would read but i no longer exports, e.g. those of removed slice elements, so
+// that a later Import doesn't resurrect them. kv must implement Getter and Deleter, and
+// Ranger for the stale entries of map fields to be found. The keys of fields with the
+// "file" tag option, which Export skips, are kept. If any value can't be exported
+// kv is left untouched and the errors are returned, as the keys of that value would
+// otherwise be taken for stale.
+func ExportReplace(i interface{}, kv Setter) error {
+	return Options{}.ExportReplace(i, kv)
+}
+
+// ExportReplace is like the package-level ExportReplace but using the options in o.
+func (o Options) ExportReplace(i interface{}, kv Setter) error {
+	g, ok := kv.(Getter)
+	d, dok := kv.(Deleter)
+	if !ok || !dok {
+		return errNotDeleter
+	}
+
+	out := NewMap()
+	if err := o.Export(i, out); err != nil {
+		return err
+	}
+
+	t := reflect.TypeOf(i)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	used := make(map[string]bool)
+	o.NoFileRefs = true
+	s := importState{walkState: newWalkState(o, i), skipFiles: true}
+	if err := s.importRoot(g, reflect.New(t), used); err != nil {
+		return err
+	}
+
+	stale := make([]string, 0, len(used))
+	for k, found := range used {
+		if _, ok := out.Lookup(k); found && !ok {
+			stale = append(stale, k)
+		}
+	}
+	sort.Strings(stale)
+	for _, k := range stale {
+		d.Delete(k)
+	}
+
+	out.Range("", func(k, v string) bool {
+		kv.Set(k, v)
+		return true
+	})
+	return nil
 }
 
 func exportWalk(v reflect.Value, sfield *structAndField, kv Setter, s *exportState) (err error) {
 	s.depth += 1
 
-	kn, knok := keyname(sfield, s.structCounter)
+	f, fok := s.field(sfield)
+	if fok {
+		defer s.reserve(sfield, f)
+	}
+
+	if fok && omitEmpty(v, sfield, f) {
+		s.depth -= 1
+		return
+	}
+
+	// values of fields with the "file" tag option come from files rather than the store
+	if _, ok := f.Option("file"); fok && ok && isField(v, sfield) {
+		s.depth -= 1
+		return
+	}
+
+	if fok && (exportCodec(v, f, kv, s) || exportMarshaler(v, f, kv, s)) {
+		s.depth -= 1
+		return
+	}
 
 	switch v.Kind() {
 	case reflect.Map:
-		err = exportMap(v, kv, s)
-	case reflect.Slice:
-		err = exportSlice(v, sfield, kv, s)
+		if fok {
+			exportMapEntries(v, sfield, f, kv, s)
+		} else {
+			err = exportMap(v, kv, s)
+		}
+	case reflect.Slice, reflect.Array:
+		if sep, ok := f.delim(); fok && ok {
+			exportDelimited(v, sfield, f, sep, kv, s)
+		} else {
+			err = exportSlice(v, sfield, kv, s)
+		}
 	case reflect.Struct:
-		err = exportStruct(v, kv, s)
-	case reflect.String:
-		if knok {
-			kv.Set(kn, v.String())
-		}
-	case reflect.Int:
-		if knok {
-			kv.Set(kn, strconv.Itoa(int(v.Int())))
-		}
-	case reflect.Interface:
-		if v.NumMethod() == 0 {
-			err = exportWalk(v.Elem(), sfield, kv, s)
-		}
-	case reflect.Ptr:
-		t := v.Interface()
-		switch t.(type) {
-		case *rsa.PrivateKey:
-			if knok {
-				pk := t.(*rsa.PrivateKey)
-				kv.Set(kn, marshalRSAPrivateKey(pk))
-			}
-		case *tls.Certificate:
-			if sfield != nil && sfield.structType != nil {
-				fname, ok := sfield.field.Tag.Lookup(structTagName)
-				if ok {
-					ct := s.structCounter.Current(v.Type())
-					exportTLSCertificate(kv, fname, ct, t.(*tls.Certificate))
-					s.structCounter.Increment(v.Type())
-				}
-			}
-		default:
-			err = exportWalk(v.Elem(), sfield, kv, s)
+		if fok && (s.opts.scheme() != nil || sfield.field.Anonymous) {
+			s.scoped(f, v.Type(), func() {
+				err = exportStruct(v, kv, s)
+			})
+		} else {
+			err = exportStruct(v, kv, s)
+		}
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Complex64, reflect.Complex128:
+		if fok {
+			kv.Set(f.Key(), formatScalar(v))
+		}
+	case reflect.Interface, reflect.Ptr:
+		err = exportWalk(v.Elem(), sfield, kv, s)
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		// nil values have nothing to export, like nil pointers
+		if fok && !v.IsNil() {
+			s.addError(f.Key(), "", &UnsupportedTypeError{v.Type()})
 		}
 	}
 	s.depth -= 1
 	return
 }
 
+// Reports whether v is the value of the field sfield, rather than e.g. one of its elements
+func isField(v reflect.Value, sfield *structAndField) bool {
+	return v.IsValid() && v.Type() == sfield.field.Type
+}
+
+// Reports whether v is the value of the field sfield and is empty with the "omitempty" tag option
+func omitEmpty(v reflect.Value, sfield *structAndField, f Field) bool {
+	if _, ok := f.Option("omitempty"); !ok || !isField(v, sfield) {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// Exports only the keys of i whose values differ from those exported for o.Baseline
+func (o Options) exportChanges(i interface{}, kv Setter) error {
+	bt, t := reflect.TypeOf(o.Baseline), reflect.TypeOf(i)
+	for bt.Kind() == reflect.Ptr {
+		bt = bt.Elem()
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if bt != t {
+		return fmt.Errorf("kvconfig: Baseline of type %v for %v", bt, t)
+	}
+
+	base, changed := NewMap(), NewMap()
+	bo := o
+	bo.Baseline = nil
+	if err := bo.Export(o.Baseline, base); err != nil {
+		return err
+	}
+	err := bo.Export(i, changed)
+	changed.Range("", func(k, v string) bool {
+		if bv, ok := base.Lookup(k); !ok || bv != v {
+			kv.Set(k, v)
+		}
+		return true
+	})
+	return err
+}
+
+// Exports v using a Codec registered for its type.
+func exportCodec(v reflect.Value, f Field, kv Setter, s *exportState) bool {
+	if !v.IsValid() || !v.CanInterface() {
+		return false
+	}
+
+	c, ok := s.opts.registry().lookup(v.Type())
+	if !ok {
+		return false
+	}
+
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return true
+	}
+
+	if err := c.Export(kv, f, v.Interface()); err != nil {
+		s.addError(f.Key(), "", err)
+	}
+	return true
+}
+
+// Exports v using its MarshalKV or MarshalText method, if it has one.
+func exportMarshaler(v reflect.Value, f Field, kv Setter, s *exportState) bool {
+	if !v.IsValid() || !v.CanInterface() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return false
+	}
+
+	m := v.Interface()
+	if v.CanAddr() {
+		m = v.Addr().Interface()
+	}
+
+	switch t := m.(type) {
+	case Marshaler:
+		if err := t.MarshalKV(kv, f); err != nil {
+			s.addError(f.Key(), "", err)
+		}
+	case encoding.TextMarshaler:
+		text, err := t.MarshalText()
+		if err != nil {
+			s.addError(f.Key(), "", err)
+		} else {
+			kv.Set(f.Key(), string(text))
+		}
+	default:
+		return false
+	}
+	return true
+}
+
 func exportStruct(v reflect.Value, kv Setter, s *exportState) (err error) {
 	s.structCounter.Increment(v.Type())
+	return exportFields(v, s.fields(v.Type()), kv, s)
+}
 
+// Exports the fields fs of the structure v, promoting those of untagged
+// embedded structures like importFields.
+func exportFields(v reflect.Value, fs fieldSet, kv Setter, s *exportState) (err error) {
 	for f := 0; f < v.NumField(); f += 1 {
-		sfield := structAndField{v.Type(), v.Type().Field(f)}
-		err = exportWalk(v.Field(f), &sfield, kv, s)
+		sfield := structAndField{structType: fs.ct, field: v.Type().Field(f)}
+		if sfield.ignored() || fs.hides(f) {
+			continue
+		}
+		s.path.push("." + sfield.field.Name)
+		if fv := v.Field(f); !s.promoted(&sfield) {
+			err = exportWalk(fv, &sfield, kv, s)
+		} else if fv.Kind() != reflect.Ptr || !fv.IsNil() {
+			et, _ := s.structType(sfield.field.Type)
+			s.structCounter.Increment(et)
+			err = exportFields(reflect.Indirect(fv), fs.embedded(f, et), kv, s)
+		}
+		s.path.pop()
 		if err != nil {
 			break
 		}
@@ -87,8 +303,18 @@ func exportStruct(v reflect.Value, kv Setter, s *exportState) (err error) {
 }
 
 func exportSlice(v reflect.Value, sfield *structAndField, kv Setter, s *exportState) (err error) {
+	esf := s.sliceField(sfield)
 	for i := 0; i < v.Len(); i += 1 {
-		err = exportWalk(v.Index(i), sfield, kv, s)
+		s.path.push(fmt.Sprintf("[%d]", i))
+		if s.opts.scheme() != nil && (esf == nil || !esf.indexed) {
+			// elements of untagged slices still have i in their paths
+			s.scoped(s.indexField(i), v.Type().Elem(), func() {
+				err = exportWalk(v.Index(i), esf, kv, s)
+			})
+		} else {
+			err = exportWalk(v.Index(i), esf.elem(i), kv, s)
+		}
+		s.path.pop()
 		if err != nil {
 			break
 		}
@@ -96,45 +322,69 @@ func exportSlice(v reflect.Value, sfield *structAndField, kv Setter, s *exportSt
 	return
 }
 
-func exportMap(v reflect.Value, kv Setter, s *exportState) (err error) {
-	for _, key := range v.MapKeys() {
-		err = exportWalk(v.MapIndex(key), nil, kv, s)
-		if err != nil {
-			break
+// Exports the elements of the slice or array v joined by sep into the single key of f
+func exportDelimited(v reflect.Value, sfield *structAndField, f Field, sep string, kv Setter, s *exportState) {
+	if v.Len() == 0 {
+		return
+	}
+
+	parts := make([]string, v.Len())
+	for i := 0; i < v.Len(); i += 1 {
+		ekv := NewMap()
+		s.path.push(fmt.Sprintf("[%d]", i))
+		errs := len(s.errs)
+		exportWalk(v.Index(i), sfield, ekv, s)
+		str, ok := ekv.Lookup(f.Key())
+		if len(s.errs) == errs && (!ok || len(*ekv) != 1) {
+			s.addError(f.Key(), "", fmt.Errorf("%s can't be stored in a delimited value", v.Type().Elem()))
+		} else if strings.Contains(str, sep) {
+			s.addError(f.Key(), "", fmt.Errorf("element contains the delimiter %q", sep))
 		}
+		s.path.pop()
+		if len(s.errs) > errs {
+			return
+		}
+		parts[i] = str
 	}
-	return
-}
 
-func marshalRSAPrivateKey(pk *rsa.PrivateKey) string {
-	der := x509.MarshalPKCS1PrivateKey(pk)
-	return base64.StdEncoding.EncodeToString(der)
+	kv.Set(f.Key(), strings.Join(parts, sep))
 }
 
-func exportTLSCertificate(kv Setter, name string, ct int, tlsCert *tls.Certificate) {
-	if tlsCert == nil {
+// Exports the entries of the map v with their keys in the key names (e.g. "labels_env_0").
+// Fields of structure values are named after the entry (e.g. "db_primary_host_0").
+func exportMapEntries(v reflect.Value, sfield *structAndField, f Field, kv Setter, s *exportState) {
+	if v.Type().Key().Kind() != reflect.String {
+		s.addError(f.Key(), "", &UnsupportedTypeError{v.Type()})
 		return
 	}
 
-	tC := *tlsCert
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	structType, isStruct := s.structType(v.Type().Elem())
 
-	for i := 0; i < len(tC.Certificate); i++ {
-		if len(tC.Certificate[i]) > 0 {
-			certStr := base64.StdEncoding.EncodeToString(tC.Certificate[i])
-			var keyName string
-			if i < 1 {
-				keyName = fmt.Sprintf("%s_cert_%d", name, ct)
-			} else {
-				keyName = fmt.Sprintf("%s_cert%d_%d", name, i+1, ct)
-			}
-			kv.Set(keyName, certStr)
+	for _, mk := range keys {
+		esf := s.entryField(sfield, mk.String())
+		ef, _ := s.field(esf)
+
+		s.path.push(fmt.Sprintf("[%q]", mk.String()))
+		if isStruct {
+			s.scoped(ef, structType, func() {
+				exportWalk(v.MapIndex(mk), nil, kv, s)
+			})
+		} else {
+			exportWalk(v.MapIndex(mk), esf, kv, s)
 		}
+		s.path.pop()
 	}
+}
 
-	if tC.PrivateKey != nil {
-		keyBytes := x509.MarshalPKCS1PrivateKey(tC.PrivateKey.(*rsa.PrivateKey))
-		keyStr := base64.StdEncoding.EncodeToString(keyBytes)
-		keyName := fmt.Sprintf("%s_pk_%d", name, ct)
-		kv.Set(keyName, keyStr)
+func exportMap(v reflect.Value, kv Setter, s *exportState) (err error) {
+	for _, key := range v.MapKeys() {
+		err = exportWalk(v.MapIndex(key), nil, kv, s)
+		if err != nil {
+			break
+		}
 	}
+	return
 }
@@ -1,6 +1,12 @@
 package kvconfig
 
-import "testing"
+import (
+	"crypto/x509"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
 
 func TestSimpleStructExport1(t *testing.T) {
 	type TestSubStruct struct {
@@ -61,3 +67,186 @@ func TestSimpleStructExport1(t *testing.T) {
 		}
 	}
 }
+
+func TestExportOmitEmpty(t *testing.T) {
+	type TestStruct struct {
+		TestString  string            `kvconfig:"test_string,omitempty"`
+		TestInt     int               `kvconfig:"test_int,omitempty"`
+		TestPtr     *int              `kvconfig:"test_ptr,omitempty"`
+		TestTimeout time.Duration     `kvconfig:"test_timeout,omitempty"`
+		TestHosts   []string          `kvconfig:"test_host,omitempty"`
+		TestTags    []string          `kvconfig:"test_tags,delim,omitempty"`
+		TestLabels  map[string]string `kvconfig:"test_labels,omitempty"`
+		TestKept    int               `kvconfig:"test_kept"`
+	}
+
+	kv := &MapStrStr{}
+	if err := Export(&TestStruct{}, kv); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if want := (MapStrStr{"test_kept_0": "0"}); !reflect.DeepEqual(*kv, want) {
+		t.Errorf("Export() = %v; wanted %v", *kv, want)
+	}
+
+	// elements are exported even if empty, so that those following keep their indexes
+	zero := 0
+	ts := TestStruct{TestPtr: &zero, TestHosts: []string{"", "a"}, TestTags: []string{"", "b"}}
+	kv = &MapStrStr{}
+	if err := Export(&ts, kv); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	want := MapStrStr{"test_ptr_0": "0", "test_host_0": "", "test_host_1": "a", "test_tags_0": ",b", "test_kept_0": "0"}
+	if !reflect.DeepEqual(*kv, want) {
+		t.Errorf("Export() = %v; wanted %v", *kv, want)
+	}
+}
+
+func TestExportBaseline(t *testing.T) {
+	type TestServer struct {
+		Host string `kvconfig:"host"`
+		Port int    `kvconfig:"port"`
+	}
+
+	type TestStruct struct {
+		LogLevel string `kvconfig:"log_level"`
+		Workers  int    `kvconfig:"workers"`
+		Servers  []TestServer
+	}
+
+	defaults := TestStruct{LogLevel: "info", Workers: 4, Servers: []TestServer{{"localhost", 80}}}
+	ts := defaults
+	ts.Workers = 8
+	ts.Servers = []TestServer{{"localhost", 8080}, {"b", 80}}
+
+	kv := &MapStrStr{}
+	if err := (Options{Baseline: defaults}).Export(&ts, kv); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	want := MapStrStr{"workers_0": "8", "port_0": "8080", "host_1": "b", "port_1": "80"}
+	if !reflect.DeepEqual(*kv, want) {
+		t.Errorf("Export() = %v; wanted %v", *kv, want)
+	}
+
+	if err := (Options{Baseline: &TestServer{}}).Export(&ts, kv); err == nil {
+		t.Errorf("Export() with a Baseline of another type succeeded")
+	}
+}
+
+func TestExportReplace(t *testing.T) {
+	type TestServer struct {
+		Host string `kvconfig:"host"`
+	}
+
+	type TestStruct struct {
+		Servers []*TestServer
+		Peers   []string          `kvconfig:"peer"`
+		Labels  map[string]string `kvconfig:"labels"`
+		Name    string            `kvconfig:"name,omitempty"`
+	}
+
+	ts := TestStruct{
+		Servers: []*TestServer{{"a"}, {"b"}, {"c"}},
+		Peers:   []string{"x", "y"},
+		Labels:  map[string]string{"env": "prod", "team": "ops"},
+		Name:    "n",
+	}
+	kv := &MapStrStr{"other_0": "kept"}
+	if err := ExportReplace(&ts, kv); err != nil {
+		t.Fatalf("ExportReplace() error = %v", err)
+	}
+
+	ts = TestStruct{
+		Servers: []*TestServer{{"a2"}},
+		Peers:   []string{"x"},
+		Labels:  map[string]string{"env": "dev"},
+	}
+	if err := ExportReplace(&ts, kv); err != nil {
+		t.Fatalf("ExportReplace() error = %v", err)
+	}
+	want := MapStrStr{"other_0": "kept", "host_0": "a2", "peer_0": "x", "labels_env_0": "dev"}
+	if !reflect.DeepEqual(*kv, want) {
+		t.Errorf("ExportReplace() = %v; wanted %v", *kv, want)
+	}
+
+	var ts2 TestStruct
+	if err := Import(kv, &ts2); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if !reflect.DeepEqual(ts2, ts) {
+		t.Errorf("Import() = %+v; wanted %+v", ts2, ts)
+	}
+
+	if err := ExportReplace(&ts, setterOnly{}); err != errNotDeleter {
+		t.Errorf("ExportReplace() error = %v; wanted %v", err, errNotDeleter)
+	}
+}
+
+func TestExportReplaceErrors(t *testing.T) {
+	type TestStruct struct {
+		Name   string         `kvconfig:"name"`
+		Secret testSecret     `kvconfig:"secret"`
+		CA     *x509.CertPool `kvconfig:"ca"`
+	}
+
+	testTable := []struct {
+		name string
+		ts   TestStruct
+	}{
+		{"MarshalText error", TestStruct{Name: "b", Secret: "bad"}},
+		{"CertPool", TestStruct{Name: "b", Secret: "ok", CA: x509.NewCertPool()}},
+	}
+
+	for _, tE := range testTable {
+		kv := &MapStrStr{"name_0": "a", "secret_0": "s3cret", "ca_0": "pem"}
+		want := MapStrStr{"name_0": "a", "secret_0": "s3cret", "ca_0": "pem"}
+		if err := ExportReplace(&tE.ts, kv); err == nil {
+			t.Errorf("%s: ExportReplace() error = nil; wanted an error", tE.name)
+		}
+		if !reflect.DeepEqual(*kv, want) {
+			t.Errorf("%s: ExportReplace() = %v; wanted the store untouched", tE.name, *kv)
+		}
+	}
+}
+
+// Fails to marshal "bad", for testing export errors
+type testSecret string
+
+func (s testSecret) MarshalText() ([]byte, error) {
+	if s == "bad" {
+		return nil, errors.New("can't marshal")
+	}
+	return []byte(s), nil
+}
+
+func (s *testSecret) UnmarshalText(text []byte) error {
+	*s = testSecret(text)
+	return nil
+}
+
+type setterOnly struct{}
+
+func (setterOnly) Set(string, string) {}
+
+func TestExportDuplicateKey(t *testing.T) {
+	type TestDB struct {
+		Host string `kvconfig:"host"`
+	}
+
+	type TestCache struct {
+		Host string `kvconfig:"host"`
+	}
+
+	type TestStruct struct {
+		DB    TestDB
+		Cache TestCache
+	}
+
+	kv := NewMap()
+	errs, ok := Export(&TestStruct{TestDB{"db"}, TestCache{"cache"}}, kv).(Errors)
+	if !ok || len(errs) != 1 || errs[0].Key != "host_0" || errs[0].Field != "TestStruct.Cache.Host" || errs[0].Err != ErrDuplicateKey {
+		t.Errorf("Export() error = %v; wanted ErrDuplicateKey for key %q", errs, "host_0")
+	}
+	if want := (MapStrStr{"host_0": "db"}); !reflect.DeepEqual(*kv, want) {
+		t.Errorf("Export() = %v; wanted %v", *kv, want)
+	}
+}
@@ -22,6 +22,10 @@ func TestTLSExport(t *testing.T) {
 
 	key, _ := x509.ParsePKCS1PrivateKey(keyBytes)
 
+	// keys are exported as PKCS #8
+	pkcs8Bytes, _ := x509.MarshalPKCS8PrivateKey(key)
+	pkcs8KeyB64 := base64.StdEncoding.EncodeToString(pkcs8Bytes)
+
 	testCert := tls.Certificate{Certificate: [][]byte{crtBytes}, PrivateKey: key}
 	testCert2 := tls.Certificate{Certificate: [][]byte{crtBytes}, PrivateKey: key}
 
@@ -36,9 +40,9 @@ func TestTLSExport(t *testing.T) {
 
 	testTable := map[string]string{
 		"tls_cert_test_cert_0": rsaCertB64,
-		"tls_cert_test_pk_0":   rsaKeyB64,
+		"tls_cert_test_pk_0":   pkcs8KeyB64,
 		"tls_cert_test_cert_1": rsaCertB64,
-		"tls_cert_test_pk_1":   rsaKeyB64,
+		"tls_cert_test_pk_1":   pkcs8KeyB64,
 	}
 
 	for k, tV := range testTable {
@@ -0,0 +1,70 @@
+package kvconfig
+
+import (
+	"os"
+	"strings"
+)
+
+// Values starting with FileRefPrefix are read from the file named by the rest of the value.
+// For example "@file:/run/secrets/tls.pem" imports the contents of /run/secrets/tls.pem.
+// Fields with the "file" tag option treat their values as file names even without the prefix.
+// The option is import-only: Export skips fields with it, as their values aren't in the store.
+const FileRefPrefix = "@file:"
+
+type fileRef struct {
+	value string
+	ok    bool
+}
+
+// Getter resolving file references in the values of an underlying Getter.
+// Files are read once and read errors are reported as KeyErrors.
+type fileGetter struct {
+	Getter
+	s     *walkState
+	paths bool
+	cache map[string]fileRef
+}
+
+func newFileGetter(kv Getter, s *walkState, paths bool) *fileGetter {
+	if fg, ok := kv.(*fileGetter); ok {
+		kv = fg.Getter
+	}
+	return &fileGetter{Getter: kv, s: s, paths: paths, cache: make(map[string]fileRef)}
+}
+
+func (g *fileGetter) Lookup(k string) (string, bool) {
+	if ref, ok := g.cache[k]; ok {
+		if ref.ok {
+			// as the underlying Getter would have counted it
+			g.s.seen += 1
+		}
+		return ref.value, ref.ok
+	}
+
+	v, ok := g.Getter.Lookup(k)
+	if ok && (g.paths || strings.HasPrefix(v, FileRefPrefix)) {
+		data, err := os.ReadFile(strings.TrimPrefix(v, FileRefPrefix))
+		if err != nil {
+			g.s.addError(k, v, err)
+			g.s.found += 1
+			v, ok = "", false
+		} else {
+			v = strings.TrimRight(string(data), "\r\n")
+		}
+	}
+
+	g.cache[k] = fileRef{v, ok}
+	return v, ok
+}
+
+func (g *fileGetter) Get(k string) string {
+	v, _ := g.Lookup(k)
+	return v
+}
+
+// Range ranges over the underlying Getter, with values not yet resolved.
+func (g *fileGetter) Range(prefix string, fn func(key, value string) bool) {
+	if r, ok := g.Getter.(Ranger); ok {
+		r.Range(prefix, fn)
+	}
+}
@@ -0,0 +1,166 @@
+package kvconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFileRefImport(t *testing.T) {
+	type TestStruct struct {
+		TestString  string `kvconfig:"test_string"`
+		TestInt     int    `kvconfig:"test_int,file"`
+		TestMissing string `kvconfig:"test_missing"`
+		TestPlain   string `kvconfig:"test_plain"`
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "string"), []byte("secret\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "int"), []byte("8080\n"), 0600)
+
+	kv := &MapStrStr{
+		"test_string_0":  FileRefPrefix + filepath.Join(dir, "string"),
+		"test_int_0":     filepath.Join(dir, "int"),
+		"test_missing_0": FileRefPrefix + filepath.Join(dir, "missing"),
+		"test_plain_0":   "plain",
+	}
+
+	ts := TestStruct{}
+
+	errs, ok := Import(kv, &ts).(Errors)
+	if !ok || len(errs) != 1 || errs[0].Key != "test_missing_0" || !os.IsNotExist(errs[0].Err) {
+		t.Errorf("Import() error = %v; wanted 1 Error for %q", errs, "test_missing_0")
+	}
+
+	if ts.TestString != "secret" {
+		t.Errorf("TestStruct.TestString = %q; wanted %q", ts.TestString, "secret")
+	}
+
+	if ts.TestInt != 8080 {
+		t.Errorf("TestStruct.TestInt = %d; wanted %d", ts.TestInt, 8080)
+	}
+
+	if ts.TestPlain != "plain" {
+		t.Errorf("TestStruct.TestPlain = %q; wanted %q", ts.TestPlain, "plain")
+	}
+
+	ts2 := TestStruct{}
+
+	(Options{NoFileRefs: true}).Import(kv, &ts2)
+
+	if ts2.TestString != kv.Get("test_string_0") {
+		t.Errorf("TestStruct.TestString = %q; wanted %q", ts2.TestString, kv.Get("test_string_0"))
+	}
+}
+
+func TestFileOptionExport(t *testing.T) {
+	type TestStruct struct {
+		TestSecret string `kvconfig:"test_secret,file,required"`
+		TestPlain  string `kvconfig:"test_plain"`
+	}
+
+	for _, ts := range []TestStruct{{"s3cret", "plain"}, {"", "plain"}} {
+		kv := &MapStrStr{}
+		if err := Export(&ts, kv); err != nil {
+			t.Errorf("Export() error = %v", err)
+		}
+		if _, ok := kv.Lookup("test_secret_0"); ok || kv.Get("test_plain_0") != "plain" {
+			t.Errorf("Export() = %v; wanted only %q", *kv, "test_plain_0")
+		}
+	}
+
+	// the file reference is kept, as the field doesn't own a value in the store
+	kv := &MapStrStr{"test_secret_0": "/run/secrets/s", "test_plain_0": "old"}
+	if err := ExportReplace(&TestStruct{"s3cret", "plain"}, kv); err != nil {
+		t.Fatalf("ExportReplace() error = %v", err)
+	}
+	if want := (MapStrStr{"test_secret_0": "/run/secrets/s", "test_plain_0": "plain"}); !reflect.DeepEqual(*kv, want) {
+		t.Errorf("ExportReplace() = %v; wanted %v", *kv, want)
+	}
+}
+
+func TestWriteEnvFileRefs(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.env")
+
+	kv := &MapStrStr{
+		"short": "short",
+		"long":  strings.Repeat("long\n", 10),
+	}
+
+	if err := kv.WriteEnvFileRefs(filename, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	kv2 := NewMap()
+
+	if err := kv2.ReadEnvFile(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := kv2.Get("short"); v != "short" {
+		t.Errorf("kv.Get(%q) = %q; wanted %q", "short", v, "short")
+	}
+
+	if v, wanted := kv2.Get("long"), FileRefPrefix+filename+".long"; v != wanted {
+		t.Errorf("kv.Get(%q) = %q; wanted %q", "long", v, wanted)
+	}
+
+	if data, _ := os.ReadFile(filename + ".long"); string(data) != kv.Get("long") {
+		t.Errorf("contents of %q = %q; wanted %q", filename+".long", data, kv.Get("long"))
+	}
+}
+
+func TestWriteEnvFileRefsUnsafeKeys(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.env")
+
+	for _, k := range []string{"labels_../../evil_0", "labels_a/b_0", `labels_a\b_0`} {
+		kv := &MapStrStr{k: strings.Repeat("long\n", 10)}
+		if err := kv.WriteEnvFileRefs(filename, 10); err == nil {
+			t.Errorf("WriteEnvFileRefs() with key %q error = nil; wanted an error", k)
+		}
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(filepath.Dir(dir), "*evil*")); len(files) > 0 {
+		t.Errorf("WriteEnvFileRefs() wrote %v", files)
+	}
+}
+
+func TestReadEnvFileQuotes(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.env")
+
+	kv := &MapStrStr{
+		"multiline": "a\nb",
+		"quoted":    `"q"`,
+	}
+	if err := kv.WriteEnvFile(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	// values quoted by hand rather than by WriteEnvFile keep their quotes
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("CFG_SPACED=\"a b\"\nCFG_PATH=\"C:\\path\"\n")
+	f.Close()
+
+	kv2 := NewMap()
+	if err := kv2.ReadEnvFile(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	testTable := map[string]string{
+		"multiline": "a\nb",
+		"quoted":    `"q"`,
+		"spaced":    `"a b"`,
+		"path":      `"C:\path"`,
+	}
+	for k, tV := range testTable {
+		if v := kv2.Get(k); v != tV {
+			t.Errorf("kv.Get(%q) = %q; wanted %q", k, v, tV)
+		}
+	}
+}
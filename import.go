@@ -1,191 +1,721 @@
 package kvconfig
 
 import (
-	"reflect"
-	"strconv"
-
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/base64"
-
-	"crypto/tls"
+	"encoding"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 )
 
 type importState struct {
-	structCounter
-	depth int
+	walkState
+	skipFiles bool // skip fields with the "file" tag option, whose keys Export doesn't set
+}
+
+// Getter supplying the "default" tag option value for a field's key when it is absent
+type defaultGetter struct {
+	Getter
+	key, value string
+	seen       *int // if not nil, counts the default as a key found
+}
+
+func (g defaultGetter) Lookup(k string) (string, bool) {
+	v, ok := g.Getter.Lookup(k)
+	if !ok && k == g.key {
+		if g.seen != nil {
+			*g.seen += 1
+		}
+		return g.value, true
+	}
+	return v, ok
+}
+
+func (g defaultGetter) Get(k string) string {
+	v, _ := g.Lookup(k)
+	return v
+}
+
+func (g defaultGetter) Range(prefix string, fn func(key, value string) bool) {
+	if r, ok := g.Getter.(Ranger); ok {
+		r.Range(prefix, fn)
+	}
+}
+
+// Getter underlying the others during an import, counting the keys found and,
+// when importing strictly, recording every key looked up and whether it was found
+type importGetter struct {
+	Getter
+	s    *walkState
+	used map[string]bool
+}
+
+func (g *importGetter) Lookup(k string) (string, bool) {
+	v, ok := g.Getter.Lookup(k)
+	if ok {
+		g.s.seen += 1
+	}
+	if g.used != nil {
+		g.used[k] = g.used[k] || ok
+	}
+	return v, ok
+}
+
+func (g *importGetter) Get(k string) string {
+	v, _ := g.Lookup(k)
+	return v
+}
+
+func (g *importGetter) Range(prefix string, fn func(key, value string) bool) {
+	if r, ok := g.Getter.(Ranger); ok {
+		r.Range(prefix, fn)
+	}
 }
 
 // Uses reflection to walk the structure i and create or set new elements from the key/value interface kv.
+// Fields whose keys are absent keep their existing values unless the field tag has a "default" option,
+// which for slices and arrays whose elements have keys of their own is the first element's value.
+// Keys whose values cannot be parsed leave their field untouched and, along with absent keys of
+// fields with the "required" tag option, are reported together in an Errors value.
+// i must be a non-nil pointer, otherwise an InvalidTargetError is returned.
 func Import(kv Getter, i interface{}) error {
-	s := importState{}
-	s.structCounter = make(structCounter)
-	return importWalk(kv, reflect.ValueOf(i), nil, &s)
+	return Options{}.Import(kv, i)
+}
+
+// Import is like the package-level Import but using the options in o.
+func (o Options) Import(kv Getter, i interface{}) error {
+	v := reflect.ValueOf(i)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return &InvalidTargetError{Op: "Import", Type: reflect.TypeOf(i)}
+	}
+	var used map[string]bool
+	if o.Strict {
+		if _, ok := kv.(Ranger); !ok {
+			return errNotRanger
+		}
+		used = make(map[string]bool)
+	}
+	s := importState{walkState: newWalkState(o, i)}
+	if err := s.importRoot(kv, v, used); err != nil {
+		return err
+	}
+	if used != nil {
+		s.unknownKeys(kv.(Ranger), used)
+	}
+	return s.err()
+}
+
+// Imports the structure v from kv, recording every key looked up in used if not nil
+func (s *importState) importRoot(kv Getter, v reflect.Value, used map[string]bool) error {
+	var g Getter = &importGetter{Getter: kv, s: &s.walkState, used: used}
+	if !s.opts.NoFileRefs {
+		g = newFileGetter(g, &s.walkState, false)
+	}
+	return importWalk(g, v, nil, s)
 }
 
 func importWalk(kv Getter, v reflect.Value, sfield *structAndField, s *importState) (err error) {
-	if (v.Kind() == reflect.Interface && v.NumMethod() == 0) || (v.Kind() == reflect.Ptr && v.Elem().Kind() != reflect.Invalid) {
+	f, fok := s.field(sfield)
+	if !fok {
+		return importValue(kv, v, sfield, f, fok, s)
+	}
+	defer s.reserve(sfield, f)
+
+	if _, ok := f.Option("file"); ok {
+		if s.skipFiles {
+			return
+		}
+		kv = newFileGetter(kv, &s.walkState, true)
+	}
+
+	if def, ok := f.Option("default"); ok && s.elementKeyed(sfield) {
+		// the default is that of the first element, which is kept though its key is absent
+		ef, _ := s.field(s.sliceField(sfield).elem(0))
+		kv = defaultGetter{kv, ef.Key(), def, &s.seen}
+	} else if ok {
+		kv = defaultGetter{kv, f.Key(), def, nil}
+	}
+
+	found, errs := s.found, len(s.errs)
+	err = importValue(kv, v, sfield, f, fok, s)
+	if err != nil {
+		return
+	}
+
+	if _, ok := f.Option("required"); ok && s.found == found {
+		s.addError(f.Key(), "", ErrRequired)
+	} else if len(s.errs) == errs {
+		for _, verr := range validateField(v, f) {
+			str, _ := kv.Lookup(f.Key())
+			s.addError(f.Key(), str, verr)
+		}
+	}
+
+	return
+}
+
+func importValue(kv Getter, v reflect.Value, sfield *structAndField, f Field, fok bool, s *importState) (err error) {
+	if fok && importCodec(kv, v, f, s) {
+		return
+	}
+
+	if v.Kind() == reflect.Ptr && v.Elem().Kind() != reflect.Invalid {
 		v = v.Elem()
 	}
 
-	kn, knok := keyname(sfield, s.structCounter)
+	if fok && importUnmarshaler(kv, v, f, s) {
+		return
+	}
 
 	s.depth += 1
 	switch v.Kind() {
 	case reflect.Struct:
-		err = importStruct(kv, v, s)
-	case reflect.Slice:
-		err = importSlice(kv, v, s)
-	case reflect.Int:
-		if knok {
-			i, _ := strconv.Atoi(kv.Get(kn))
-			v.SetInt(int64(i))
-		}
-	case reflect.String:
-		if knok {
-			v.SetString(kv.Get(kn))
+		if fok && (s.opts.scheme() != nil || sfield.field.Anonymous) {
+			s.scoped(f, v.Type(), func() {
+				err = importStruct(kv, v, s)
+			})
+		} else {
+			err = importStruct(kv, v, s)
+		}
+	case reflect.Map:
+		if fok {
+			importMap(kv, v, sfield, f, s)
+		}
+	case reflect.Slice, reflect.Array:
+		if sep, ok := f.delim(); fok && ok {
+			importDelimited(kv, v, sfield, f, sep, s)
+		} else if v.Kind() == reflect.Array {
+			err = importArray(kv, v, sfield, s)
+		} else {
+			err = importSlice(kv, v, sfield, s)
+		}
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Complex64, reflect.Complex128:
+		if fok {
+			importScalar(kv, v, f, s)
 		}
 	case reflect.Ptr:
-		if knok {
-			t := v.Interface()
-			switch t.(type) {
-			case *rsa.PrivateKey:
-				cert := unmarshalRSAPrivateKey(kv.Get(kn))
-				v.Set(reflect.ValueOf(cert))
-			case *tls.Certificate:
-				n, ct, ok := keynameRaw(sfield, s.structCounter)
-				if ok {
-					tlsCert, ok := importTLSCertificate(kv, n, ct)
-					if ok {
-						s.structCounter.Increment(v.Type())
-						v.Set(reflect.ValueOf(tlsCert))
-					}
-				}
-			default:
-				switch v.Type().Elem().Kind() {
-				case reflect.Int, reflect.String:
-					v.Set(reflect.New(v.Type().Elem()))
-					err = importWalk(kv, v, sfield, s)
-				}
+		if !isScalarKind(v.Type().Elem().Kind()) {
+			err = importPointer(kv, v, sfield, f, fok, s)
+		} else if fok {
+			if _, ok := kv.Lookup(f.Key()); ok {
+				v.Set(reflect.New(v.Type().Elem()))
+				importScalar(kv, v.Elem(), f, s)
 			}
 		}
+	case reflect.Interface:
+		err = importInterface(kv, v, sfield, f, fok, s)
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		importUnsupported(kv, v, f, fok, s)
 	}
 	s.depth -= 1
 
 	return
 }
 
-func importSlice(kv Getter, v reflect.Value, s *importState) (err error) {
+// Imports into the dynamic value of the interface v or, if nil, a new value of the
+// concrete type registered for v's type, which is only set if any of its keys are present.
+func importInterface(kv Getter, v reflect.Value, sfield *structAndField, f Field, fok bool, s *importState) (err error) {
+	var e reflect.Value
+	if !v.IsNil() {
+		e = reflect.New(v.Elem().Type()).Elem()
+		e.Set(v.Elem())
+	} else if t, ok := s.opts.registry().impl(v.Type()); ok {
+		e = reflect.New(t).Elem()
+		if t.Kind() == reflect.Ptr {
+			e.Set(reflect.New(t.Elem()))
+		}
+	} else {
+		importUnsupported(kv, v, f, fok, s)
+		return
+	}
+
+	m := s.mark()
+	if err = importValue(kv, e, sfield, f, fok, s); err != nil || s.unseen(m) {
+		return
+	}
+	v.Set(e)
+	return
+}
+
+// Reports the key of f, whose value can't be imported into v, if it is present.
+// Fields of unsupported types whose keys are absent are left untouched.
+func importUnsupported(kv Getter, v reflect.Value, f Field, fok bool, s *importState) {
+	if !fok {
+		return
+	}
+	if str, ok := kv.Lookup(f.Key()); ok {
+		s.addError(f.Key(), str, &UnsupportedTypeError{v.Type()})
+	}
+}
+
+// Imports into a new value for the nil pointer v, which is only set if any of its
+// keys are present. Pointers to pointers are allocated in turn.
+func importPointer(kv Getter, v reflect.Value, sfield *structAndField, f Field, fok bool, s *importState) (err error) {
+	p := reflect.New(v.Type().Elem())
+	m := s.mark()
+	if err = importValue(kv, p.Elem(), sfield, f, fok, s); err != nil || s.unseen(m) {
+		return
+	}
+	v.Set(p)
+	return
+}
+
+// Imports v using a Codec registered for its type, or for the type it points to.
+// Nil pointers are only allocated when a value was imported.
+func importCodec(kv Getter, v reflect.Value, f Field, s *importState) bool {
+	if !v.IsValid() || !v.CanInterface() {
+		return false
+	}
+
+	t := v.Type()
+	c, ok := s.opts.registry().lookup(t)
+	ptr := false
+	if !ok && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		c, ok = s.opts.registry().lookup(t)
+		ptr = true
+	}
+	if !ok {
+		return false
+	}
+
+	i, err := c.Import(kv, f)
+	if err == ErrKeyNotFound {
+		return true
+	}
+	s.found += 1
+	var cv reflect.Value
+	if err == nil {
+		cv, err = codecValue(i, t)
+	}
+	if err != nil {
+		str, _ := kv.Lookup(f.Key())
+		s.addError(f.Key(), str, err)
+		return true
+	}
+
+	if ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(t))
+		}
+		v.Elem().Set(cv)
+	} else {
+		v.Set(cv)
+	}
+	return true
+}
+
+// Imports v using its UnmarshalKV or UnmarshalText method, if it has one.
+// Nil pointers are only allocated when a value was imported.
+func importUnmarshaler(kv Getter, v reflect.Value, f Field, s *importState) bool {
+	if !v.CanInterface() {
+		return false
+	}
+	var p reflect.Value
+	alloc := v.Kind() == reflect.Ptr && v.IsNil()
+	if alloc {
+		p = reflect.New(v.Type().Elem())
+	} else if v.CanAddr() {
+		p = v.Addr()
+	} else {
+		return false
+	}
+
+	switch u := p.Interface().(type) {
+	case Unmarshaler:
+		err := u.UnmarshalKV(kv, f)
+		if err == ErrKeyNotFound {
+			return true
+		}
+		s.found += 1
+		if err != nil {
+			str, _ := kv.Lookup(f.Key())
+			s.addError(f.Key(), str, err)
+			return true
+		}
+	case encoding.TextUnmarshaler:
+		str, ok := kv.Lookup(f.Key())
+		if !ok {
+			return true
+		}
+		s.found += 1
+		if err := u.UnmarshalText([]byte(str)); err != nil {
+			s.addError(f.Key(), str, err)
+			return true
+		}
+	default:
+		return false
+	}
+
+	if alloc {
+		v.Set(p)
+	}
+	return true
+}
+
+func importScalar(kv Getter, v reflect.Value, f Field, s *importState) {
+	if str, ok := kv.Lookup(f.Key()); ok {
+		s.found += 1
+		if err := parseScalar(v, str); err != nil {
+			s.addError(f.Key(), str, err)
+		}
+	}
+}
+
+// Imports the elements of the slice v. Existing elements are imported in place.
+// Slices of structs grow while keys of the next structure are present, other
+// slices of tagged fields (and any slice with a KeyScheme) while keys of
+// the next element are.
+func importSlice(kv Getter, v reflect.Value, sfield *structAndField, s *importState) (err error) {
+	esf := s.sliceField(sfield)
 	for i := 0; i < v.Len(); i += 1 {
-		err = importWalk(kv, v.Index(i), nil, s)
+		s.path.push(fmt.Sprintf("[%d]", i))
+		err = importIndex(kv, v.Index(i), esf, i, s)
+		s.path.pop()
 		if err != nil {
-			break
+			return
 		}
 	}
 
 	sliceType := v.Type().Elem()
-	structCand := sliceType
-
-	if sliceType.Kind() == reflect.Ptr {
-		structCand = sliceType.Elem()
-	}
-
-	if structCand.Kind() == reflect.Struct {
-		for newStruct, ok := importNewStruct(kv, structCand, s); ok; newStruct, ok = importNewStruct(kv, structCand, s) {
-
-			// Grow the slice if necessary.
-			// Borrowed from https://golang.org/src/encoding/xml/read.go
-			n := v.Len()
-			if n >= v.Cap() {
-				ncap := 2 * n
-				if ncap < 4 {
-					ncap = 4
-				}
-				new := reflect.MakeSlice(v.Type(), n, ncap)
-				reflect.Copy(new, v)
-				v.Set(new)
+	structType, isStruct := s.structType(sliceType)
+
+	if isStruct && s.opts.scheme() == nil {
+		for newStruct, ok := importNewStruct(kv, structType, s); ok; newStruct, ok = importNewStruct(kv, structType, s) {
+			n := growSlice(v)
+			e := v.Index(n)
+			if sliceType.Kind() == reflect.Ptr {
+				e.Set(newStruct)
+				e = e.Elem()
+			}
+
+			s.path.push(fmt.Sprintf("[%d]", n))
+			err = importStruct(kv, e, s)
+			s.path.pop()
+			if err != nil {
+				return
+			}
+		}
+	} else if s.opts.scheme() != nil || (esf != nil && esf.indexed) {
+		for n := v.Len(); ; n += 1 {
+			e := reflect.New(sliceType).Elem()
+			if isStruct && sliceType.Kind() == reflect.Ptr {
+				e.Set(reflect.New(structType))
 			}
 
-			v.SetLen(n + 1)
-			v.Index(n).Set(newStruct)
+			m := s.mark()
+			s.path.push(fmt.Sprintf("[%d]", n))
+			err = importIndex(kv, e, esf, n, s)
+			s.path.pop()
+			if err != nil {
+				return
+			}
 
-			err = importStruct(kv, newStruct.Elem(), s)
+			// past the last element, whose fields may still have defaults or be required
+			if s.unseen(m) {
+				return
+			}
+			v.Index(growSlice(v)).Set(e)
 		}
 	}
 
 	return
 }
 
-func importStruct(kv Getter, v reflect.Value, s *importState) (err error) {
-	s.structCounter.Increment(v.Type())
-
-	for f := 0; f < v.NumField(); f += 1 {
-		sfield := structAndField{v.Type(), v.Type().Field(f)}
-		err = importWalk(kv, v.Field(f), &sfield, s)
+// Imports the elements of the array v by index. Keys of the element past its end
+// are reported, other than when counting structures, whose keys aren't indexed.
+func importArray(kv Getter, v reflect.Value, sfield *structAndField, s *importState) (err error) {
+	esf := s.sliceField(sfield)
+	for i := 0; i < v.Len(); i += 1 {
+		s.path.push(fmt.Sprintf("[%d]", i))
+		err = importIndex(kv, v.Index(i), esf, i, s)
+		s.path.pop()
 		if err != nil {
-			break
+			return
 		}
 	}
+
+	if _, isStruct := s.structType(v.Type().Elem()); isStruct && s.opts.scheme() == nil {
+		return
+	}
+	if s.opts.scheme() == nil && (esf == nil || !esf.indexed) {
+		return
+	}
+
+	m := s.mark()
+	s.path.push(fmt.Sprintf("[%d]", v.Len()))
+	defer s.path.pop()
+	if err = importIndex(kv, reflect.New(v.Type().Elem()).Elem(), esf, v.Len(), s); err != nil || s.unseen(m) {
+		return
+	}
+	s.undo(m)
+	key := ""
+	if ef, ok := s.field(esf.elem(v.Len())); ok {
+		key = ef.Key()
+	}
+	s.addError(key, "", ErrArrayOverflow)
 	return
 }
 
-func importNewStruct(kv Getter, t reflect.Type, s *importState) (reflect.Value, bool) {
-	if t.Kind() != reflect.Struct {
-		return reflect.Value{}, false
+// Imports the i'th element of a slice whose elements have the field esf from sliceField.
+// With a KeyScheme elements of untagged slices still have i in their paths.
+func importIndex(kv Getter, v reflect.Value, esf *structAndField, i int, s *importState) (err error) {
+	if s.opts.scheme() != nil && (esf == nil || !esf.indexed) {
+		s.scoped(s.indexField(i), v.Type(), func() {
+			err = importElem(kv, v, esf, s)
+		})
+		return
 	}
-	var newStruct reflect.Value
-	var newStructPtr reflect.Value
+	return importElem(kv, v, esf.elem(i), s)
+}
 
-	for f := 0; f < t.NumField(); f += 1 {
-		field := t.Field(f)
-		kn, knok := keyname(&structAndField{t, field}, s.structCounter)
-		if _, ok := kv.Lookup(kn); knok && ok {
-			if !newStruct.IsValid() {
-				newStructPtr = reflect.New(t)
-				newStruct = newStructPtr.Elem()
-				break
-			}
+// Imports a slice element, which shares its slice field's tag options but
+// isn't subject to them (e.g. "default" and "required" apply to the slice)
+func importElem(kv Getter, v reflect.Value, esf *structAndField, s *importState) error {
+	f, fok := s.field(esf)
+	if fok {
+		defer s.reserve(esf, f)
+	}
+	return importValue(kv, v, esf, f, fok, s)
+}
+
+// Grows the slice v by one zero element, returning its index.
+func growSlice(v reflect.Value) int {
+	// Borrowed from https://golang.org/src/encoding/xml/read.go
+	n := v.Len()
+	if n >= v.Cap() {
+		ncap := 2 * n
+		if ncap < 4 {
+			ncap = 4
 		}
+		new := reflect.MakeSlice(v.Type(), n, ncap)
+		reflect.Copy(new, v)
+		v.Set(new)
 	}
 
-	return newStructPtr, reflect.Value{} != newStruct
+	v.SetLen(n + 1)
+	return n
 }
 
-func unmarshalRSAPrivateKey(s string) *rsa.PrivateKey {
-	x509bytes, _ := base64.StdEncoding.DecodeString(s)
-	cert, _ := x509.ParsePKCS1PrivateKey(x509bytes)
-	return cert
+// Imports the slice or array v from the single key of f holding its elements separated
+// by sep, replacing any existing elements. Whitespace around elements is ignored.
+func importDelimited(kv Getter, v reflect.Value, sfield *structAndField, f Field, sep string, s *importState) {
+	str, ok := kv.Lookup(f.Key())
+	if !ok {
+		return
+	}
+	s.found += 1
+
+	var parts []string
+	if strings.TrimSpace(str) != "" {
+		parts = strings.Split(str, sep)
+	}
+
+	var nv reflect.Value
+	if v.Kind() == reflect.Array {
+		if len(parts) > v.Len() {
+			s.addError(f.Key(), str, ErrArrayOverflow)
+			return
+		}
+		nv = reflect.New(v.Type()).Elem()
+	} else {
+		nv = reflect.MakeSlice(v.Type(), len(parts), len(parts))
+	}
+
+	errs := len(s.errs)
+	for i, part := range parts {
+		s.path.push(fmt.Sprintf("[%d]", i))
+		importValue(&MapStrStr{f.Key(): strings.TrimSpace(part)}, nv.Index(i), sfield, f, true, s)
+		s.path.pop()
+	}
+
+	if len(s.errs) == errs {
+		v.Set(nv)
+	}
 }
 
-func importTLSCertificate(kv Getter, name string, ct int) (*tls.Certificate, bool) {
-	_, certOk := kv.Lookup(fmt.Sprintf("%s_cert_%d", name, ct))
-	keyStr, keyOk := kv.Lookup(fmt.Sprintf("%s_pk_%d", name, ct))
+// Imports the entries of the map v, whose keys are found by listing those of kv
+// starting with the key name of f. Entries are merged into any existing ones.
+func importMap(kv Getter, v reflect.Value, sfield *structAndField, f Field, s *importState) {
+	if v.Type().Key().Kind() != reflect.String {
+		s.addError(f.Key(), "", &UnsupportedTypeError{v.Type()})
+		return
+	}
 
-	if !keyOk || !certOk {
-		return nil, false
+	prefix := f.entryPrefix()
+	keys, ok := listKeys(kv, prefix)
+	if !ok {
+		return
 	}
 
-	tC := tls.Certificate{}
+	valueType := v.Type().Elem()
+	structType, isStruct := s.structType(valueType)
+
+	for _, key := range mapKeyCandidates(keys, prefix) {
+		esf := s.entryField(sfield, key)
+		ef, _ := s.field(esf)
+
+		mk := reflect.ValueOf(key).Convert(v.Type().Key())
+		e := reflect.New(valueType).Elem()
+		if cur := v.MapIndex(mk); cur.IsValid() {
+			e.Set(cur)
+		} else if isStruct && valueType.Kind() == reflect.Ptr {
+			e.Set(reflect.New(structType))
+		}
 
-	for i := 0; ; i++ {
-		var keyName string
-		if i < 1 {
-			keyName = fmt.Sprintf("%s_cert_%d", name, ct)
+		m := s.mark()
+		s.path.push(fmt.Sprintf("[%q]", key))
+		if isStruct {
+			s.scoped(ef, structType, func() {
+				importValue(kv, e, nil, Field{}, false, s)
+			})
 		} else {
-			keyName = fmt.Sprintf("%s_cert%d_%d", name, i+1, ct)
+			importElem(kv, e, esf, s)
 		}
+		s.path.pop()
 
-		if certStr, ok := kv.Lookup(keyName); ok {
-			certBytes, _ := base64.StdEncoding.DecodeString(certStr)
-			tC.Certificate = append(tC.Certificate, certBytes)
+		// not an entry, but a key of another sharing its prefix
+		if s.unseen(m) {
+			continue
+		}
+
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		v.SetMapIndex(mk, e)
+	}
+}
+
+// Returns the possible map keys of entries stored under keys starting with prefix.
+// Map keys and the rest of the keys of entries may both contain separators (e.g.
+// "_" or "."), so every part of a key up to a separator, or all of it, is a candidate.
+func mapKeyCandidates(keys []string, prefix string) []string {
+	seen := make(map[string]bool)
+	var candidates []string
+	for _, k := range keys {
+		rest := strings.TrimPrefix(k, prefix)
+		for i := 1; i <= len(rest); i++ {
+			if (i == len(rest) || isSeparator(rest[i])) && !seen[rest[:i]] {
+				seen[rest[:i]] = true
+				candidates = append(candidates, rest[:i])
+			}
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+func isSeparator(c byte) bool {
+	return !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9')
+}
+
+func importStruct(kv Getter, v reflect.Value, s *importState) (err error) {
+	s.structCounter.Increment(v.Type())
+
+	if err = importFields(kv, v, s.fields(v.Type()), s); err != nil {
+		return
+	}
+
+	validateStruct(v, s)
+	return
+}
+
+// Imports the fields fs of the structure v.
+// Like encoding/json, fields of untagged embedded structures are promoted
+// into their parent's keys.
+func importFields(kv Getter, v reflect.Value, fs fieldSet, s *importState) (err error) {
+	for f := 0; f < v.NumField(); f += 1 {
+		sfield := structAndField{structType: fs.ct, field: v.Type().Field(f)}
+		if sfield.ignored() || fs.hides(f) {
+			continue
+		}
+		s.path.push("." + sfield.field.Name)
+		if s.promoted(&sfield) {
+			et, _ := s.structType(sfield.field.Type)
+			err = importEmbedded(kv, v.Field(f), fs.embedded(f, et), s)
 		} else {
-			break
+			err = importWalk(kv, v.Field(f), &sfield, s)
+		}
+		s.path.pop()
+		if err != nil {
+			return
 		}
 	}
+	return
+}
+
+// Imports the fields of the embedded structure v into its parent's keys.
+// Nil pointers are only allocated when any of its keys are present.
+func importEmbedded(kv Getter, v reflect.Value, fs fieldSet, s *importState) (err error) {
+	if v.Kind() != reflect.Ptr {
+		s.structCounter.Increment(fs.ct)
+		return importFields(kv, v, fs, s)
+	}
+	if !v.IsNil() {
+		s.structCounter.Increment(fs.ct)
+		return importFields(kv, v.Elem(), fs, s)
+	}
 
-	keyBytes, _ := base64.StdEncoding.DecodeString(keyStr)
-	tC.PrivateKey, _ = x509.ParsePKCS1PrivateKey(keyBytes)
+	p := reflect.New(v.Type().Elem())
+	m := s.mark()
+	s.structCounter.Increment(fs.ct)
+	if err = importFields(kv, p.Elem(), fs, s); err != nil || s.unseen(m) {
+		return
+	}
+	if !v.CanSet() {
+		s.addError("", "", fmt.Errorf("cannot set embedded pointer to unexported struct %s", p.Type().Elem()))
+		return
+	}
+	v.Set(p)
+	return
+}
+
+func importNewStruct(kv Getter, t reflect.Type, s *importState) (reflect.Value, bool) {
+	if t.Kind() != reflect.Struct || !s.nextKeys(kv, t, t) {
+		return reflect.Value{}, false
+	}
+	return reflect.New(t), true
+}
 
-	return &tC, true
+// Reports whether a key of a field of t would be present for the next structure of type ct.
+// The promoted fields of embedded structures are only looked at when t has no keyed fields
+// of its own, as they are counted by the embedded type, which other structures may share.
+func (s *importState) nextKeys(kv Getter, t, ct reflect.Type) bool {
+	var embedded []reflect.Type
+	own := false
+	for f := 0; f < t.NumField(); f += 1 {
+		sfield := structAndField{structType: ct, field: t.Field(f)}
+		if sfield.ignored() {
+			continue
+		}
+		if s.promoted(&sfield) {
+			et, _ := s.structType(sfield.field.Type)
+			embedded = append(embedded, et)
+			continue
+		}
+		sf, knok := s.field(&sfield)
+		if !knok {
+			continue
+		}
+		own = true
+		sf.index = s.structCounter.Current(ct)
+		if s.elementKeyed(&sfield) {
+			// the first element of a slice field, e.g. "host_1_0"
+			sf.path = appendPath(sf.path, KeySegment{Index: sf.index, IsIndex: true})
+			sf.index = 0
+		}
+		if _, ok := kv.Lookup(sf.Key()); ok {
+			return true
+		}
+	}
+	for _, et := range embedded {
+		if !own && s.nextKeys(kv, et, et) {
+			return true
+		}
+	}
+	return false
 }
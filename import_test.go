@@ -1,6 +1,10 @@
 package kvconfig
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+	"time"
+)
 
 func TestSimpleStructImport1(t *testing.T) {
 	type TestSubStruct struct {
@@ -81,3 +85,194 @@ func TestSimpleStructImport1(t *testing.T) {
 	}
 
 }
+
+func TestImportErrors(t *testing.T) {
+	type TestSubStruct struct {
+		TestSubInt int `kvconfig:"test_sub_int"`
+	}
+
+	type TestStruct struct {
+		TestInt    int    `kvconfig:"test_int"`
+		TestString string `kvconfig:"test_string"`
+		SubStructs []*TestSubStruct
+	}
+
+	ts := TestStruct{}
+
+	kv := &MapStrStr{
+		"test_int_0":     "80a",
+		"test_string_0":  "test",
+		"test_sub_int_0": "x",
+	}
+
+	err := Import(kv, &ts)
+
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("Import() error = %v; wanted Errors", err)
+	}
+
+	testTable := []KeyError{
+		{Key: "test_int_0", Field: "TestStruct.TestInt", Value: "80a"},
+		{Key: "test_sub_int_0", Field: "TestStruct.SubStructs[0].TestSubInt", Value: "x"},
+	}
+
+	if len(errs) != len(testTable) {
+		t.Fatalf("len(Errors) = %d; wanted %d: %v", len(errs), len(testTable), errs)
+	}
+
+	for i, tE := range testTable {
+		if errs[i].Key != tE.Key || errs[i].Field != tE.Field || errs[i].Value != tE.Value || errs[i].Err == nil {
+			t.Errorf("Errors[%d] = %+v; wanted %+v", i, *errs[i], tE)
+		}
+	}
+
+	if ts.TestInt != 0 {
+		t.Errorf("TestStruct.TestInt = %d; wanted %d", ts.TestInt, 0)
+	}
+
+	if ts.TestString != "test" {
+		t.Errorf("TestStruct.TestString = %q; wanted %q", ts.TestString, "test")
+	}
+}
+
+func TestImportDefaultsRequired(t *testing.T) {
+	type TestStruct struct {
+		TestPort     int            `kvconfig:"test_port,default=8080,required"`
+		TestHost     string         `kvconfig:"test_host,required"`
+		TestName     string         `kvconfig:"test_name,required"`
+		TestPreset   string         `kvconfig:"test_preset"`
+		TestList     string         `kvconfig:"test_list,default=a\\,b"`
+		TestTimeout  time.Duration  `kvconfig:"test_timeout,default=30s"`
+		TestPtrInt   *int           `kvconfig:"test_ptr_int"`
+		TestPtrDef   *int           `kvconfig:"test_ptr_def,default=5"`
+		TestInterval *time.Duration `kvconfig:"test_interval"`
+	}
+
+	ts := TestStruct{
+		TestPreset: "preset",
+	}
+
+	kv := &MapStrStr{
+		"test_name_0": "name",
+	}
+
+	errs, ok := Import(kv, &ts).(Errors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("Import() error = %v; wanted 1 Error", errs)
+	}
+
+	if errs[0].Key != "test_host_0" || errs[0].Err != ErrRequired {
+		t.Errorf("Errors[0] = %+v; wanted key %q and ErrRequired", *errs[0], "test_host_0")
+	}
+
+	if ts.TestPort != 8080 {
+		t.Errorf("TestStruct.TestPort = %d; wanted %d", ts.TestPort, 8080)
+	}
+
+	if ts.TestName != "name" {
+		t.Errorf("TestStruct.TestName = %q; wanted %q", ts.TestName, "name")
+	}
+
+	if ts.TestPreset != "preset" {
+		t.Errorf("TestStruct.TestPreset = %q; wanted %q", ts.TestPreset, "preset")
+	}
+
+	if ts.TestList != "a,b" {
+		t.Errorf("TestStruct.TestList = %q; wanted %q", ts.TestList, "a,b")
+	}
+
+	if ts.TestTimeout != 30*time.Second {
+		t.Errorf("TestStruct.TestTimeout = %v; wanted %v", ts.TestTimeout, 30*time.Second)
+	}
+
+	if ts.TestPtrInt != nil {
+		t.Errorf("*(TestStruct.TestPtrInt) = %d; wanted nil", *ts.TestPtrInt)
+	}
+
+	if ts.TestPtrDef == nil || *ts.TestPtrDef != 5 {
+		t.Errorf("TestStruct.TestPtrDef = %v; wanted pointer to %d", ts.TestPtrDef, 5)
+	}
+
+	if ts.TestInterval != nil {
+		t.Errorf("*(TestStruct.TestInterval) = %v; wanted nil", *ts.TestInterval)
+	}
+
+	kv.Set("test_port_0", "80")
+
+	ts.TestPort = 0
+
+	Import(kv, &ts)
+
+	if ts.TestPort != 80 {
+		t.Errorf("TestStruct.TestPort = %d; wanted %d", ts.TestPort, 80)
+	}
+}
+
+func TestImportSliceDefault(t *testing.T) {
+	type TestStruct struct {
+		Hosts []string `kvconfig:"hosts,default=localhost"`
+		Ports [2]int   `kvconfig:"ports,default=80"`
+		Tags  []string `kvconfig:"tags,delim=;,default=a;b"`
+	}
+
+	testTable := []struct {
+		o    Options
+		kv   MapStrStr
+		want TestStruct
+	}{
+		{Options{}, MapStrStr{}, TestStruct{[]string{"localhost"}, [2]int{80, 0}, []string{"a", "b"}}},
+		{Options{Scheme: DottedScheme{}}, MapStrStr{}, TestStruct{[]string{"localhost"}, [2]int{80, 0}, []string{"a", "b"}}},
+		{Options{}, MapStrStr{"hosts_0": "a", "hosts_1": "b", "ports_1": "443"}, TestStruct{[]string{"a", "b"}, [2]int{80, 443}, []string{"a", "b"}}},
+	}
+
+	for _, tE := range testTable {
+		ts := TestStruct{}
+		if err := tE.o.Import(&tE.kv, &ts); err != nil {
+			t.Fatalf("Import() error = %v", err)
+		}
+		if !reflect.DeepEqual(ts, tE.want) {
+			t.Errorf("Import(%v) = %+v; wanted %+v", tE.kv, ts, tE.want)
+		}
+	}
+}
+
+func TestInvalidTarget(t *testing.T) {
+	type TestStruct struct {
+		TestInt int `kvconfig:"test_int"`
+	}
+
+	kv := &MapStrStr{"test_int_0": "80"}
+	var nilStruct *TestStruct
+	var nilIface interface{}
+
+	testTable := []struct {
+		name string
+		fn   func() error
+		want string
+	}{
+		{"Import(nil)", func() error { return Import(kv, nil) }, "kvconfig: Import(nil)"},
+		{"Import(struct)", func() error { return Import(kv, TestStruct{}) }, "kvconfig: Import(non-pointer kvconfig.TestStruct)"},
+		{"Import(nil pointer)", func() error { return Import(kv, nilStruct) }, "kvconfig: Import(nil *kvconfig.TestStruct)"},
+		{"Import(nil interface)", func() error { return Import(kv, nilIface) }, "kvconfig: Import(nil)"},
+		{"Options.Import(struct)", func() error { return Options{Strict: true}.Import(kv, TestStruct{}) }, "kvconfig: Import(non-pointer kvconfig.TestStruct)"},
+		{"Export(nil)", func() error { return Export(nil, kv) }, "kvconfig: Export(nil)"},
+		{"Export(nil pointer)", func() error { return Export(nilStruct, kv) }, "kvconfig: Export(nil *kvconfig.TestStruct)"},
+	}
+
+	for _, tt := range testTable {
+		err := tt.fn()
+		ierr, ok := err.(*InvalidTargetError)
+		if !ok {
+			t.Errorf("%s error = %v; wanted InvalidTargetError", tt.name, err)
+			continue
+		}
+		if ierr.Error() != tt.want {
+			t.Errorf("%s error = %q; wanted %q", tt.name, ierr.Error(), tt.want)
+		}
+	}
+
+	if err := Export(TestStruct{TestInt: 80}, kv); err != nil {
+		t.Errorf("Export(struct) error = %v", err)
+	}
+}
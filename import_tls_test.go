@@ -49,3 +49,45 @@ func TestTLSImport(t *testing.T) {
 		}
 	}
 }
+
+func TestTLSImportErrors(t *testing.T) {
+	type TestStruct struct {
+		TLSCert *tls.Certificate `kvconfig:"tls_cert_test"`
+		RSAKey  *rsa.PrivateKey  `kvconfig:"rsa_key_test"`
+	}
+
+	kv := &MapStrStr{
+		"tls_cert_test_cert_0": "MIID",
+		"tls_cert_test_pk_0":   "not base64!",
+		"rsa_key_test_0":       "bm90IGEga2V5",
+	}
+
+	ts := TestStruct{}
+
+	err := Import(kv, &ts)
+
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("Import() error = %v; wanted Errors", err)
+	}
+
+	if len(errs) != 2 {
+		t.Fatalf("len(Errors) = %d; wanted 2: %v", len(errs), errs)
+	}
+
+	if errs[0].Key != "tls_cert_test_cert_0" || errs[0].Field != "TestStruct.TLSCert" {
+		t.Errorf("Errors[0] = %+v; wanted key %q", *errs[0], "tls_cert_test_cert_0")
+	}
+
+	if errs[1].Key != "rsa_key_test_0" || errs[1].Field != "TestStruct.RSAKey" {
+		t.Errorf("Errors[1] = %+v; wanted key %q", *errs[1], "rsa_key_test_0")
+	}
+
+	if ts.TLSCert != nil {
+		t.Error("TestStruct.TLSCert != nil")
+	}
+
+	if ts.RSAKey != nil {
+		t.Error("TestStruct.RSAKey != nil")
+	}
+}
@@ -1,14 +1,28 @@
 // Package kvconfig implements a system of mapping Go structures to and from key/value stores.
 //
 // Key names end in an underscore and integer (e.g. "_2").
-// This is to facilitate e.g. arrays of structures and the multiple values they hold.
+// This is to facilitate e.g. arrays of structures and the multiple values they hold,
+// with the integer counting the structures of each type seen so far. Options.Scheme
+// names keys after the tags of the fields leading to values instead (see KeyScheme).
+// Elements of tagged slice and array fields take successive indexes (e.g. "host_0", "host_1"),
+// or are joined into a single key with the "delim" tag option (e.g. `kvconfig:"host,delim"`).
+// Elements of nested slices add their own indexes (e.g. "groups_1_0" for Groups[1][0]),
+// as do those of slice fields of structures other than the root (e.g. "host_1_0" for
+// Servers[1].Hosts[0]) when counting structures.
+// Entries of tagged map fields with string keys include the map key (e.g. "labels_env_0"),
+// and are only imported from stores implementing Ranger, such as MapStrStr.
 // When parsing CLI arguments or envvars names may be transformed to conform.
-// When specified on structures the field tag is "kvconfig" followed by the key name.
+// When specified on structures the field tag is "kvconfig" followed by the key name
+// and optionally a comma-separated list of options (e.g. `kvconfig:"start,layout=2006-01-02"`).
+// Untagged fields are ignored unless Options.AutoKeys names them after the fields,
+// and fields tagged `kvconfig:"-"` are always ignored.
 package kvconfig
 
 import (
+	"encoding"
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 const structTagName = "kvconfig"
@@ -22,6 +36,469 @@ type Getter interface {
 	Lookup(string) (string, bool)
 }
 
+// Ranger is implemented by key/value stores whose keys can be enumerated.
+// Import uses it, when available, to discover the entries of map fields.
+type Ranger interface {
+	// Range calls fn for each key starting with prefix (every key if prefix is
+	// empty) and its value, stopping early if fn returns false.
+	Range(prefix string, fn func(key, value string) bool)
+}
+
+// Deleter is implemented by key/value stores whose keys can be removed.
+// ExportReplace uses it to delete the keys of values no longer exported.
+type Deleter interface {
+	Delete(string)
+}
+
+// Returns the keys of kv starting with prefix, if kv is a Ranger
+func listKeys(kv Getter, prefix string) ([]string, bool) {
+	r, ok := kv.(Ranger)
+	if !ok {
+		return nil, false
+	}
+	var keys []string
+	r.Range(prefix, func(k, _ string) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys, true
+}
+
+// Marshaler is implemented by types that export themselves, possibly across several keys.
+type Marshaler interface {
+	MarshalKV(kv Setter, f Field) error
+}
+
+// Unmarshaler is implemented by types that import themselves, possibly from several keys.
+// UnmarshalKV should return ErrKeyNotFound if none of its keys are present.
+type Unmarshaler interface {
+	UnmarshalKV(kv Getter, f Field) error
+}
+
+// Field locates the value of a tagged struct field in a key/value store.
+type Field struct {
+	path  []KeySegment
+	index int // of the structure, or slice element, when counting structures
+	opts  tagOptions
+	o     *Options
+}
+
+// Key returns the key holding the field's value (e.g. "port_0").
+func (f Field) Key() string {
+	if sc := f.scheme(); sc != nil {
+		return sc.Key(f.path)
+	}
+	return fmt.Sprintf("%s_%d", f.name(), f.index)
+}
+
+// SubKey returns the key holding one part of a value stored across several keys (e.g. "tls_cert_0").
+func (f Field) SubKey(part string) string {
+	if sc := f.scheme(); sc != nil {
+		return sc.Key(appendPath(f.path, KeySegment{Name: part}))
+	}
+	return fmt.Sprintf("%s_%s_%d", f.name(), part, f.index)
+}
+
+func (f Field) scheme() KeyScheme {
+	if f.o == nil {
+		return nil
+	}
+	return f.o.scheme()
+}
+
+// Key name of f without its index when counting structures, e.g. "labels_env"
+func (f Field) name() string {
+	parts := make([]string, len(f.path))
+	for i, seg := range f.path {
+		parts[i] = seg.String()
+	}
+	return strings.Join(parts, "_")
+}
+
+// Returns the start of the keys of the entries of a map field
+func (f Field) entryPrefix() string {
+	e := f
+	e.path = appendPath(f.path, KeySegment{Name: "\x00"})
+	k := e.Key()
+	return k[:strings.Index(k, "\x00")]
+}
+
+// Appends to a copy of path, which may share its array with other paths
+func appendPath(path []KeySegment, segs ...KeySegment) []KeySegment {
+	return append(path[:len(path):len(path)], segs...)
+}
+
+// Option returns the value of a field tag option and whether it was present.
+func (f Field) Option(name string) (string, bool) {
+	return f.opts.Get(name)
+}
+
+// Returns the separator of a slice field stored as a single delimited value.
+// The "delim" tag option without a value separates elements with commas.
+func (f Field) delim() (string, bool) {
+	sep, ok := f.Option("delim")
+	if ok && sep == "" {
+		sep = ","
+	}
+	return sep, ok
+}
+
+// Go path of the field being walked (e.g. "Config.Servers[1].Port"), for error reporting
+type fieldPath []string
+
+func (p fieldPath) String() string {
+	return strings.Join(p, "")
+}
+
+func (p *fieldPath) push(elem string) {
+	*p = append(*p, elem)
+}
+
+func (p *fieldPath) pop() {
+	*p = (*p)[:len(*p)-1]
+}
+
+// Next unused index of each key name, so that slice elements sharing a
+// field's tag get their own keys (e.g. "tls_cert_0" followed by "tls_cert_1")
+type keyCounter map[string]int
+
+// Returns a copy of sfield for the elements of a slice field. When counting
+// structures, elements of slice fields of the root structure are indexed from the
+// next unused index of their key name, and those of other structures follow the
+// structure's index (e.g. "host_1_0" for Servers[1].Hosts[0]), so that the elements
+// of each structure are told apart.
+func (s *walkState) sliceField(sfield *structAndField) *structAndField {
+	f, ok := s.field(sfield)
+	if !ok {
+		return sfield
+	}
+	esf := *sfield
+	if sfield.indexed {
+		// an element of a slice of slices, whose elements follow its index (e.g. "groups_1_0")
+		esf.segs = appendPath(sfield.segs, KeySegment{Index: sfield.index, IsIndex: true})
+		esf.index = 0
+	} else if s.opts.scheme() == nil && sfield.structType != s.root {
+		esf.segs = appendPath(sfield.segs, KeySegment{Index: f.index, IsIndex: true})
+		esf.index = 0
+	} else if s.opts.scheme() == nil {
+		esf.index = s.keys[f.name()]
+	}
+	esf.indexed = true
+	return &esf
+}
+
+// Reports whether the elements of the field sfield are stored under keys of their
+// own (from sliceField) rather than the field's key
+func (s *walkState) elementKeyed(sfield *structAndField) bool {
+	t := sfield.field.Type
+	if s.custom(t) {
+		return false
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		return false
+	}
+	if _, opts, ok := s.tag(sfield); !ok || opts.Has("delim") {
+		return false
+	}
+	_, isStruct := s.structType(t.Elem())
+	return !isStruct
+}
+
+// Returns a copy of sfield for the entry of a map field with key k. With a KeyScheme
+// the entries of the map of a slice element follow its index (e.g. "a.0.k").
+func (s *walkState) entryField(sfield *structAndField, k string) *structAndField {
+	esf := *sfield
+	if sfield.indexed && s.opts.scheme() != nil {
+		esf.segs = appendPath(sfield.segs, KeySegment{Index: sfield.index, IsIndex: true})
+		esf.indexed, esf.index = false, 0
+	}
+	esf.segs = appendPath(esf.segs, KeySegment{Name: k})
+	return &esf
+}
+
+// Returns the field for the i'th element of a slice field from sliceField
+func (esf *structAndField) elem(i int) *structAndField {
+	if esf == nil || !esf.indexed {
+		return esf
+	}
+	e := *esf
+	e.index += i
+	return &e
+}
+
+// State shared by the import and export walkers
+type walkState struct {
+	structCounter
+	keys  keyCounter
+	opts  *Options
+	root  reflect.Type // of the structure walked
+	depth int
+	path  fieldPath
+	errs  Errors
+	found int // number of values imported (or failing to import)
+	seen  int // number of keys found in the store
+	scope keyScope
+}
+
+// Location of the keys of the value being walked, other than by counting structures
+type keyScope struct {
+	path []KeySegment // prefixing the paths of fields, e.g. of a map entry
+}
+
+func newWalkState(o Options, i interface{}) walkState {
+	s := walkState{
+		structCounter: make(structCounter),
+		keys:          make(keyCounter),
+		opts:          &o,
+	}
+	if t := reflect.TypeOf(i); t != nil {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		s.root = t
+		s.path.push(t.Name())
+	}
+	return s
+}
+
+// Progress of a walk, for undoing the import of a value none of whose keys are present
+type walkMark struct {
+	seen, found, errs int
+	counts            structCounter
+	keys              keyCounter
+}
+
+func (s *walkState) mark() walkMark {
+	m := walkMark{seen: s.seen, found: s.found, errs: len(s.errs)}
+	m.counts = make(structCounter, len(s.structCounter))
+	for t, n := range s.structCounter {
+		m.counts[t] = n
+	}
+	m.keys = make(keyCounter, len(s.keys))
+	for k, n := range s.keys {
+		m.keys[k] = n
+	}
+	return m
+}
+
+// Reports whether no keys were found since m, in which case the walk since m is
+// undone, so that e.g. a structure that isn't kept isn't counted either
+func (s *walkState) unseen(m walkMark) bool {
+	if s.seen != m.seen {
+		return false
+	}
+	s.undo(m)
+	return true
+}
+
+// Undoes the walk since m, other than counting the keys found
+func (s *walkState) undo(m walkMark) {
+	s.found, s.errs = m.found, s.errs[:m.errs]
+	s.structCounter, s.keys = m.counts, m.keys
+}
+
+// Walks fn over the value of f (e.g. a map entry) with the paths of its fields
+// starting with f's. When counting structures, keys are counted afresh starting
+// with structures of type t at the index of f.
+func (s *walkState) scoped(f Field, t reflect.Type, fn func()) {
+	sc, keys, scope := s.structCounter, s.keys, s.scope
+	s.structCounter, s.keys = structCounter{t: f.index}, make(keyCounter)
+	s.scope.path = f.path
+	fn()
+	s.structCounter, s.keys, s.scope = sc, keys, scope
+}
+
+// Returns the location of the i'th element of an untagged slice, which with a
+// KeyScheme is in the path of the fields of structure elements
+func (s *walkState) indexField(i int) Field {
+	return Field{path: appendPath(s.scope.path, KeySegment{Index: i, IsIndex: true}), o: s.opts}
+}
+
+// Derives the path and index (when counting structures) of the tagged field sfield
+func (s *walkState) keyname(sfield *structAndField) ([]KeySegment, int, bool) {
+	name, _, ok := s.tag(sfield)
+	if !ok {
+		return nil, 0, false
+	}
+	ct := structIndex(sfield, s.structCounter)
+	return appendPath(s.scope.path, KeySegment{Name: name}), ct, true
+}
+
+// Reports whether values of type t are handled by a Codec, or by marshaling
+// methods, rather than field by field
+func (s *walkState) custom(t reflect.Type) bool {
+	if _, ok := s.opts.registry().lookup(t); ok {
+		return true
+	}
+	if t.Kind() == reflect.Ptr {
+		if _, ok := s.opts.registry().lookup(t.Elem()); ok {
+			return true
+		}
+	} else {
+		t = reflect.PtrTo(t)
+	}
+	for _, it := range customTypes {
+		if t.Implements(it) {
+			return true
+		}
+	}
+	return false
+}
+
+var customTypes = []reflect.Type{
+	reflect.TypeOf((*Marshaler)(nil)).Elem(),
+	reflect.TypeOf((*Unmarshaler)(nil)).Elem(),
+	reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem(),
+	reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem(),
+}
+
+// Returns the structure type of values of type t walked field by field, if any
+func (s *walkState) structType(t reflect.Type) (reflect.Type, bool) {
+	if s.custom(t) {
+		return nil, false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t, t.Kind() == reflect.Struct
+}
+
+// Reports whether sfield is an untagged embedded structure, whose fields are
+// promoted into its parent's keys. Tagged embedded structures prefix the keys of
+// their fields with the tag instead.
+func (s *walkState) promoted(sfield *structAndField) bool {
+	if !sfield.field.Anonymous {
+		return false
+	}
+	if name, _, ok := sfield.tag(); ok && name != "" {
+		return false
+	}
+	_, ok := s.structType(sfield.field.Type)
+	return ok
+}
+
+// The fields of a structure walked field by field, or of an untagged structure embedded
+// in it at index, which are counted as structures of type ct
+type fieldSet struct {
+	ct     reflect.Type
+	index  []int
+	hidden map[string]bool // index paths of the fields hidden by others with the same key name
+}
+
+// Returns the fields of the structure type t. Like encoding/json, of the fields with the
+// same key name promoted from embedded structures, the shallowest hides the others, and
+// those at the same depth hide each other. Fields of t itself sharing a key name don't,
+// but take successive indexes (see keyCounter).
+func (s *walkState) fields(t reflect.Type) fieldSet {
+	byName := make(map[string][][]int)
+	var collect func(t reflect.Type, index []int, visited map[reflect.Type]bool)
+	collect = func(t reflect.Type, index []int, visited map[reflect.Type]bool) {
+		visited[t] = true
+		defer delete(visited, t)
+		for f := 0; f < t.NumField(); f += 1 {
+			sfield := structAndField{structType: t, field: t.Field(f)}
+			if sfield.ignored() {
+				continue
+			}
+			fi := append(index[:len(index):len(index)], f)
+			if s.promoted(&sfield) {
+				if et, _ := s.structType(sfield.field.Type); !visited[et] {
+					collect(et, fi, visited)
+				}
+			} else if name, _, ok := s.tag(&sfield); ok {
+				byName[name] = append(byName[name], fi)
+			}
+		}
+	}
+	collect(t, nil, make(map[reflect.Type]bool))
+
+	fs := fieldSet{ct: t, hidden: make(map[string]bool)}
+	for _, indexes := range byName {
+		depth, n := -1, 0
+		for _, fi := range indexes {
+			if depth == -1 || len(fi) < depth {
+				depth, n = len(fi), 1
+			} else if len(fi) == depth {
+				n += 1
+			}
+		}
+		for _, fi := range indexes {
+			if len(fi) > depth || (n > 1 && depth > 1) {
+				fs.hidden[fmt.Sprint(fi)] = true
+			}
+		}
+	}
+	return fs
+}
+
+// Reports whether the f'th field of the structure is hidden by another
+func (fs fieldSet) hides(f int) bool {
+	return len(fs.hidden) > 0 && fs.hidden[fmt.Sprint(append(fs.index[:len(fs.index):len(fs.index)], f))]
+}
+
+// Returns the fields of the structure of type t embedded as the f'th field, which
+// are counted as structures of type t so that structures embedding the same type
+// don't share keys when counting structures
+func (fs fieldSet) embedded(f int, t reflect.Type) fieldSet {
+	fs.ct = t
+	fs.index = append(fs.index[:len(fs.index):len(fs.index)], f)
+	return fs
+}
+
+func (s *walkState) addError(key, value string, err error) {
+	if kerr, ok := err.(*KeyError); ok {
+		if kerr.Field == "" {
+			kerr.Field = s.path.String()
+		}
+		s.errs = append(s.errs, kerr)
+		return
+	}
+	s.errs = append(s.errs, &KeyError{Key: key, Field: s.path.String(), Value: value, Err: err})
+}
+
+// Returns the collected errors, or nil if there were none
+func (s *walkState) err() error {
+	if len(s.errs) > 0 {
+		return s.errs
+	}
+	return nil
+}
+
+// Derives the location of the tagged field sfield in the key/value store
+func (s *walkState) field(sfield *structAndField) (Field, bool) {
+	path, ct, ok := s.keyname(sfield)
+	if !ok {
+		return Field{}, false
+	}
+	path = append(path, sfield.segs...)
+	if sfield.indexed {
+		if s.opts.scheme() != nil {
+			path = append(path, KeySegment{Index: sfield.index, IsIndex: true})
+		} else {
+			ct = sfield.index
+		}
+	}
+	_, opts, _ := s.tag(sfield)
+	return Field{path: path, index: ct, opts: opts, o: s.opts}, true
+}
+
+// Marks the index of the key name of sfield's field f as used, once its value has
+// been walked. Slice fields reserve their index after their elements, which start
+// from the next unused index, so a lone slice field stores its elements from "_0".
+// Slice fields of other structures than the root don't, as their elements follow
+// the structure's index instead (see sliceField).
+func (s *walkState) reserve(sfield *structAndField, f Field) {
+	if s.opts.scheme() == nil && !sfield.indexed && sfield.structType != s.root && s.elementKeyed(sfield) {
+		return
+	}
+	if name := f.name(); f.index >= s.keys[name] {
+		s.keys[name] = f.index + 1
+	}
+}
+
 type structCounter map[reflect.Type]int
 
 func (s structCounter) Increment(t reflect.Type) {
@@ -41,32 +518,57 @@ func (s structCounter) Current(t reflect.Type) int {
 type structAndField struct {
 	structType reflect.Type
 	field      reflect.StructField
+	indexed    bool // an element of a slice field, stored at index
+	index      int
+	segs       []KeySegment // following the tag: indexes of enclosing slice elements and keys of map entries
 }
 
-// Tries to derive a numeric-ending key name from the number of times we've seen a structure
-func keyname(sfield *structAndField, c structCounter) (string, bool) {
-	name, ct, ok := keynameRaw(sfield, c)
-
-	if !ok {
-		return "", false
+// Reports whether the field is tagged `kvconfig:"-"` or unexported, and so can't be
+// walked, other than an embedded structure whose exported fields are promoted (like encoding/json)
+func (sfield *structAndField) ignored() bool {
+	if sfield.field.Tag.Get(structTagName) == "-" {
+		return true
+	}
+	if sfield.field.PkgPath == "" {
+		return false
+	}
+	t := sfield.field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
 	}
+	return !sfield.field.Anonymous || t.Kind() != reflect.Struct
+}
 
-	return fmt.Sprintf("%s_%d", name, ct), true
+// Returns the key name and options of sfield from its tag or, with Options.AutoKeys,
+// the field's name when its tag has none (e.g. "tls_cert" for TLSCert)
+func (s *walkState) tag(sfield *structAndField) (string, tagOptions, bool) {
+	name, opts, ok := sfield.tag()
+	if s.opts.AutoKeys && name == "" && sfield != nil && sfield.structType != nil {
+		return snakeCase(sfield.field.Name), opts, true
+	}
+	return name, opts, ok
 }
 
-func keynameRaw(sfield *structAndField, c structCounter) (string, int, bool) {
+// Returns the key name and options from the field's tag
+func (sfield *structAndField) tag() (string, tagOptions, bool) {
 	if sfield == nil || sfield.structType == nil {
-		return "", 0, false
+		return "", nil, false
 	}
-	lTagName, ok := sfield.field.Tag.Lookup(structTagName)
+	tag, ok := sfield.field.Tag.Lookup(structTagName)
 	if !ok {
-		return "", 0, false
+		return "", nil, false
 	}
+	name, opts := parseTag(tag)
+	return name, opts, true
+}
+
+// Returns the index of the structure holding sfield among those of its type
+func structIndex(sfield *structAndField, c structCounter) int {
 	ct := c.Current(sfield.structType)
 	if ct >= 1 {
 		ct = ct - 1
 	} else {
 		ct = 0
 	}
-	return lTagName, ct, true
+	return ct
 }
@@ -4,10 +4,13 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 )
 
-// MapStrStr is a very simple implementation satisfying the Getter and Setter interfaces
+// MapStrStr is a very simple implementation satisfying the Getter, Setter, Ranger and Deleter interfaces
 type MapStrStr map[string]string
 
 func NewMap() *MapStrStr {
@@ -28,7 +31,60 @@ func (m *MapStrStr) Lookup(k string) (string, bool) {
 	return v, ok
 }
 
+func (m *MapStrStr) Delete(k string) {
+	delete(*m, k)
+}
+
+// Range calls fn for each key starting with prefix, in sorted order.
+func (m *MapStrStr) Range(prefix string, fn func(key, value string) bool) {
+	keys := make([]string, 0, len(*m))
+	for k := range *m {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !fn(k, (*m)[k]) {
+			return
+		}
+	}
+}
+
+// Quotes env file values which span multiple lines (e.g. PEM encoded certificates)
+// with Go escaping, which ReadEnvFile reverses.
+func quoteEnvValue(v string) string {
+	if strings.ContainsAny(v, "\r\n") || strings.HasPrefix(v, `"`) {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// Reverses quoteEnvValue. Other quoted values (e.g. written by hand) are kept as they are.
+func unquoteEnvValue(v string) string {
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		if uq, err := strconv.Unquote(v); err == nil && quoteEnvValue(uq) == v {
+			return uq
+		}
+	}
+	return v
+}
+
 func (m *MapStrStr) WriteEnvFile(filename string) error {
+	return m.writeEnvFile(filename, 0)
+}
+
+// WriteEnvFileRefs is like WriteEnvFile but values of at least size bytes are written
+// to their own files next to the env file (named after it and the key, e.g.
+// "app.env.tls_cert_pk_0") and referenced with FileRefPrefix instead.
+func (m *MapStrStr) WriteEnvFileRefs(filename string, size int) error {
+	if size < 1 {
+		size = 1
+	}
+	return m.writeEnvFile(filename, size)
+}
+
+func (m *MapStrStr) writeEnvFile(filename string, refSize int) error {
 	f, err := os.Create(filename)
 
 	if err != nil {
@@ -38,7 +94,23 @@ func (m *MapStrStr) WriteEnvFile(filename string) error {
 	defer f.Close()
 
 	for k, v := range *m {
-		_, err := f.WriteString(fmt.Sprintf("CFG_%s=%s\n", strings.ToUpper(k), v))
+		if refSize > 0 && len(v) >= refSize {
+			// keys of map entries come from data, so mustn't name files elsewhere
+			if strings.ContainsAny(k, `/\`) || strings.Contains(k, "..") {
+				return fmt.Errorf("key %q can't name a file referenced from %s", k, filename)
+			}
+			refFilename, err := filepath.Abs(fmt.Sprintf("%s.%s", filename, k))
+			if err != nil {
+				return err
+			}
+			// referenced values are likely to be certificates, keys or other secrets
+			if err := os.WriteFile(refFilename, []byte(v), 0600); err != nil {
+				return err
+			}
+			v = FileRefPrefix + refFilename
+		}
+
+		_, err := f.WriteString(fmt.Sprintf("CFG_%s=%s\n", strings.ToUpper(k), quoteEnvValue(v)))
 		if err != nil {
 			return err
 		}
@@ -75,7 +147,7 @@ func (m *MapStrStr) ReadEnvFile(filename string) error {
 			continue
 		}
 
-		m.Set(strings.ToLower(line[4:eqPos]), line[eqPos+1:])
+		m.Set(strings.ToLower(line[4:eqPos]), unquoteEnvValue(line[eqPos+1:]))
 	}
 
 	return scanner.Err()
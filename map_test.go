@@ -0,0 +1,184 @@
+package kvconfig
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMapRoundTrip(t *testing.T) {
+	type TestDB struct {
+		Host string `kvconfig:"host"`
+		Port int    `kvconfig:"port"`
+	}
+
+	type TestServer struct {
+		Name   string            `kvconfig:"name"`
+		Labels map[string]string `kvconfig:"server_labels"`
+	}
+
+	type TestStruct struct {
+		Labels  map[string]string  `kvconfig:"labels"`
+		Limits  map[string]int     `kvconfig:"limit"`
+		DBs     map[string]*TestDB `kvconfig:"db"`
+		Servers []*TestServer
+	}
+
+	ts := TestStruct{
+		Labels: map[string]string{"env": "prod", "team_name": "core"},
+		Limits: map[string]int{"conns": 10},
+		DBs: map[string]*TestDB{
+			"primary":      {Host: "db1", Port: 5432},
+			"read_replica": {Host: "db2"},
+		},
+		Servers: []*TestServer{
+			{Name: "a", Labels: map[string]string{"zone": "1"}},
+			{Name: "b", Labels: map[string]string{"zone": "2"}},
+		},
+	}
+
+	kv := NewMap()
+
+	if err := Export(&ts, kv); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	testTable := map[string]string{
+		"labels_env_0":           "prod",
+		"labels_team_name_0":     "core",
+		"limit_conns_0":          "10",
+		"db_primary_host_0":      "db1",
+		"db_primary_port_0":      "5432",
+		"db_read_replica_host_0": "db2",
+		"db_read_replica_port_0": "0",
+		"name_0":                 "a",
+		"server_labels_zone_0":   "1",
+		"name_1":                 "b",
+		"server_labels_zone_1":   "2",
+	}
+
+	for k, tV := range testTable {
+		if v, ok := kv.Lookup(k); ok == false {
+			t.Errorf("kv.Lookup(%q) = _, false; wanted _, true", k)
+		} else if v != tV {
+			t.Errorf("kv.Lookup(%q) = %q, _; wanted %q, _", k, v, tV)
+		}
+	}
+
+	if len(*kv) != len(testTable) {
+		t.Errorf("len(kv) = %d; wanted %d: %v", len(*kv), len(testTable), *kv)
+	}
+
+	ts2 := TestStruct{Labels: map[string]string{"owner": "ops"}}
+
+	if err := Import(kv, &ts2); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	ts.Labels["owner"] = "ops"
+
+	if !reflect.DeepEqual(ts2, ts) {
+		t.Errorf("Import() = %+v; wanted %+v", ts2, ts)
+	}
+
+	kv.Set("limit_conns_0", "x")
+
+	errs, ok := Import(kv, &ts2).(Errors)
+	if !ok || len(errs) != 1 || errs[0].Key != "limit_conns_0" || errs[0].Field != `TestStruct.Limits["conns"]` {
+		t.Errorf("Import() error = %v; wanted error for key %q", errs, "limit_conns_0")
+	}
+}
+
+func TestNestedMapRoundTrip(t *testing.T) {
+	type TestStruct struct {
+		Counts map[string]map[string]int `kvconfig:"c"`
+	}
+
+	ts := TestStruct{Counts: map[string]map[string]int{"k1": {"z": 1}, "k2": {"z": 2, "y": 3}}}
+
+	testTable := []struct {
+		o    Options
+		keys MapStrStr
+	}{
+		{Options{}, MapStrStr{"c_k1_z_0": "1", "c_k2_z_0": "2", "c_k2_y_0": "3"}},
+		{Options{Scheme: DottedScheme{}}, MapStrStr{"c.k1.z": "1", "c.k2.z": "2", "c.k2.y": "3"}},
+	}
+
+	for _, tE := range testTable {
+		kv := NewMap()
+		if err := tE.o.Export(&ts, kv); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if !reflect.DeepEqual(*kv, tE.keys) {
+			t.Errorf("Export() = %v; wanted %v", *kv, tE.keys)
+		}
+
+		ts2 := TestStruct{}
+		if err := tE.o.Import(kv, &ts2); err != nil {
+			t.Fatalf("Import() error = %v", err)
+		}
+		if !reflect.DeepEqual(ts2, ts) {
+			t.Errorf("Import() = %+v; wanted %+v", ts2, ts)
+		}
+	}
+}
+
+// Store implementing Getter and Ranger but not MapStrStr
+type testRangeStore struct {
+	m MapStrStr
+}
+
+func (s testRangeStore) Get(k string) string {
+	return s.m[k]
+}
+
+func (s testRangeStore) Lookup(k string) (string, bool) {
+	v, ok := s.m[k]
+	return v, ok
+}
+
+func (s testRangeStore) Range(prefix string, fn func(key, value string) bool) {
+	s.m.Range(prefix, fn)
+}
+
+func TestRange(t *testing.T) {
+	kv := &MapStrStr{
+		"labels_b_0": "2",
+		"labels_a_0": "1",
+		"label_c_0":  "3",
+		"port_0":     "80",
+	}
+
+	var keys []string
+	kv.Range("labels_", func(k, v string) bool {
+		keys = append(keys, k+"="+v)
+		return true
+	})
+
+	if want := []string{"labels_a_0=1", "labels_b_0=2"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("MapStrStr.Range(%q) = %q; wanted %q", "labels_", keys, want)
+	}
+
+	n := 0
+	kv.Range("", func(k, v string) bool {
+		n += 1
+		return n < 3
+	})
+
+	if n != 3 {
+		t.Errorf("MapStrStr.Range(%q) called fn %d times after stopping; wanted %d", "", n, 3)
+	}
+
+	type TestStruct struct {
+		Labels map[string]int `kvconfig:"labels"`
+	}
+
+	ts := TestStruct{}
+
+	if err := Import(testRangeStore{*kv}, &ts); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	if want := map[string]int{"a": 1, "b": 2}; !reflect.DeepEqual(ts.Labels, want) {
+		t.Errorf("TestStruct.Labels = %v; wanted %v", ts.Labels, want)
+	}
+}
@@ -0,0 +1,156 @@
+package kvconfig
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+)
+
+type testLevel int
+
+func (l testLevel) MarshalText() ([]byte, error) {
+	switch l {
+	case 0:
+		return []byte("info"), nil
+	case 1:
+		return []byte("debug"), nil
+	}
+	return nil, errors.New("unknown level")
+}
+
+func (l *testLevel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "info":
+		*l = 0
+	case "debug":
+		*l = 1
+	default:
+		return errors.New("unknown level")
+	}
+	return nil
+}
+
+type testEndpoint struct {
+	Host string
+	Port int
+}
+
+func (e *testEndpoint) MarshalKV(kv Setter, f Field) error {
+	kv.Set(f.SubKey("host"), e.Host)
+	kv.Set(f.SubKey("port"), strconv.Itoa(e.Port))
+	return nil
+}
+
+func (e *testEndpoint) UnmarshalKV(kv Getter, f Field) error {
+	host, ok := kv.Lookup(f.SubKey("host"))
+	if !ok {
+		return ErrKeyNotFound
+	}
+	port, err := strconv.Atoi(kv.Get(f.SubKey("port")))
+	if err != nil {
+		return err
+	}
+	e.Host, e.Port = host, port
+	return nil
+}
+
+func TestMarshalerRoundTrip(t *testing.T) {
+	type TestStruct struct {
+		TestLevel       testLevel     `kvconfig:"test_level"`
+		TestIP          net.IP        `kvconfig:"test_ip"`
+		TestEndpoint    testEndpoint  `kvconfig:"test_endpoint"`
+		TestPtrEndpoint *testEndpoint `kvconfig:"test_ptr_endpoint"`
+		TestNilEndpoint *testEndpoint `kvconfig:"test_nil_endpoint"`
+	}
+
+	ts := TestStruct{
+		TestLevel:       1,
+		TestIP:          net.ParseIP("192.0.2.1"),
+		TestEndpoint:    testEndpoint{"example.com", 443},
+		TestPtrEndpoint: &testEndpoint{"example.net", 8443},
+	}
+
+	kv := NewMap()
+
+	if err := Export(&ts, kv); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	testTable := map[string]string{
+		"test_level_0":             "debug",
+		"test_ip_0":                "192.0.2.1",
+		"test_endpoint_host_0":     "example.com",
+		"test_endpoint_port_0":     "443",
+		"test_ptr_endpoint_host_0": "example.net",
+		"test_ptr_endpoint_port_0": "8443",
+	}
+
+	if len(*kv) != len(testTable) {
+		t.Errorf("len(kv) = %d; wanted %d", len(*kv), len(testTable))
+	}
+
+	for k, tV := range testTable {
+		if v, ok := kv.Lookup(k); ok == false {
+			t.Errorf("kv.Lookup(%q) = _, false; wanted _, true", k)
+		} else if v != tV {
+			t.Errorf("kv.Lookup(%q) = %q, _; wanted %q, _", k, v, tV)
+		}
+	}
+
+	ts2 := TestStruct{}
+
+	if err := Import(kv, &ts2); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	if ts2.TestLevel != ts.TestLevel {
+		t.Errorf("TestStruct.TestLevel = %v; wanted %v", ts2.TestLevel, ts.TestLevel)
+	}
+
+	if !ts2.TestIP.Equal(ts.TestIP) {
+		t.Errorf("TestStruct.TestIP = %v; wanted %v", ts2.TestIP, ts.TestIP)
+	}
+
+	if ts2.TestEndpoint != ts.TestEndpoint {
+		t.Errorf("TestStruct.TestEndpoint = %+v; wanted %+v", ts2.TestEndpoint, ts.TestEndpoint)
+	}
+
+	if ts2.TestPtrEndpoint == nil {
+		t.Error("TestStruct.TestPtrEndpoint == nil")
+	} else if *ts2.TestPtrEndpoint != *ts.TestPtrEndpoint {
+		t.Errorf("*(TestStruct.TestPtrEndpoint) = %+v; wanted %+v", *ts2.TestPtrEndpoint, *ts.TestPtrEndpoint)
+	}
+
+	if ts2.TestNilEndpoint != nil {
+		t.Errorf("TestStruct.TestNilEndpoint = %+v; wanted nil", *ts2.TestNilEndpoint)
+	}
+}
+
+func TestUnmarshalerErrors(t *testing.T) {
+	type TestStruct struct {
+		TestLevel    testLevel    `kvconfig:"test_level"`
+		TestEndpoint testEndpoint `kvconfig:"test_endpoint"`
+	}
+
+	kv := &MapStrStr{
+		"test_level_0":         "verbose",
+		"test_endpoint_host_0": "example.com",
+		"test_endpoint_port_0": "https",
+	}
+
+	ts := TestStruct{}
+
+	errs, ok := Import(kv, &ts).(Errors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("Import() error = %v; wanted 2 Errors", errs)
+	}
+
+	if errs[0].Key != "test_level_0" || errs[0].Value != "verbose" {
+		t.Errorf("Errors[0] = %+v; wanted key %q", *errs[0], "test_level_0")
+	}
+
+	if errs[1].Key != "test_endpoint_0" || errs[1].Field != "TestStruct.TestEndpoint" {
+		t.Errorf("Errors[1] = %+v; wanted key %q", *errs[1], "test_endpoint_0")
+	}
+}
@@ -0,0 +1,54 @@
+package kvconfig
+
+// Options configures how structures are imported from and exported to key/value stores.
+// The zero value is the behaviour of the package-level Import and Export.
+type Options struct {
+	// Registry holds the codecs for types needing special handling.
+	// DefaultRegistry is used if nil.
+	Registry *Registry
+
+	// PEM exports certificates and keys PEM encoded rather than as base64 DER,
+	// as if every such field had the "pem" tag option.
+	PEM bool
+
+	// NoFileRefs disables reading values from files referenced with FileRefPrefix on import.
+	NoFileRefs bool
+
+	// Strict reports keys in the store that no field imported, suggesting the closest
+	// key that was looked for (see ImportStrict). The store must implement Ranger.
+	Strict bool
+
+	// PathKeys names the keys of nested structures after the tags of the fields
+	// leading to them rather than counting structures of each type, and ends them
+	// in the index of the innermost slice element (or 0). For example:
+	//
+	//	Config.PrimaryDB.Host      `kvconfig:"primary_db"` then `kvconfig:"host"` is "primary_db_host_0"
+	//	Config.Servers[1].Host     "servers_host_1"
+	//	Config.Servers[1].Peers[2] "servers_1_peers_2"
+	//
+	// Untagged structure fields add nothing to key names. PathKeys is shorthand for PathScheme.
+	PathKeys bool
+
+	// Scheme derives key names from the tags of the fields leading to values,
+	// rather than counting structures of each type (e.g. PathScheme or DottedScheme).
+	// It's also used by Options.ParseArgs and Options.ParseEnv to name keys.
+	Scheme KeyScheme
+
+	// AutoKeys names untagged fields, and those whose tags have only options (e.g.
+	// `kvconfig:",required"`), after the fields in snake_case, e.g. "tls_cert" for TLSCert.
+	// Untagged embedded structures are still promoted. Options.ParseArgs and
+	// Options.ParseEnv convert names likewise, e.g. "--TLSCert" to "tls_cert_0".
+	AutoKeys bool
+
+	// Baseline is a structure of the type exported, typically holding its defaults.
+	// If set, Export only sets the keys whose values differ from those exported for
+	// Baseline, e.g. so that env files written from the store hold just the overrides.
+	Baseline interface{}
+}
+
+func (o Options) registry() *Registry {
+	if o.Registry == nil {
+		return DefaultRegistry
+	}
+	return o.Registry
+}
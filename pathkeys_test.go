@@ -0,0 +1,92 @@
+package kvconfig
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathKeysRoundTrip(t *testing.T) {
+	type TestDB struct {
+		Host string `kvconfig:"host"`
+		Port int    `kvconfig:"port"`
+	}
+
+	type TestPeer struct {
+		Addr string `kvconfig:"addr"`
+		Port int    `kvconfig:"port,default=22"`
+	}
+
+	type TestServer struct {
+		Host  string      `kvconfig:"host"`
+		Tags  []string    `kvconfig:"tags"`
+		Peers []*TestPeer `kvconfig:"peers"`
+	}
+
+	type TestStruct struct {
+		Name    string            `kvconfig:"name"`
+		Replica TestDB            `kvconfig:"replica_db"`
+		Primary *TestDB           `kvconfig:"primary_db"`
+		Servers []TestServer      `kvconfig:"servers"`
+		Labels  map[string]string `kvconfig:"labels"`
+	}
+
+	ts := TestStruct{
+		Name:    "test",
+		Replica: TestDB{Host: "db2", Port: 5433},
+		Primary: &TestDB{Host: "db1", Port: 5432},
+		Servers: []TestServer{
+			{Host: "a", Tags: []string{"x", "y"}},
+			{Host: "b", Peers: []*TestPeer{{Addr: "c", Port: 22}, {Addr: "d", Port: 2222}}},
+		},
+		Labels: map[string]string{"env": "prod"},
+	}
+
+	o := Options{PathKeys: true}
+
+	kv := NewMap()
+
+	if err := o.Export(&ts, kv); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	testTable := map[string]string{
+		"name_0":                 "test",
+		"replica_db_host_0":      "db2",
+		"replica_db_port_0":      "5433",
+		"primary_db_host_0":      "db1",
+		"primary_db_port_0":      "5432",
+		"servers_host_0":         "a",
+		"servers_0_tags_0":       "x",
+		"servers_0_tags_1":       "y",
+		"servers_host_1":         "b",
+		"servers_1_peers_addr_0": "c",
+		"servers_1_peers_port_0": "22",
+		"servers_1_peers_addr_1": "d",
+		"servers_1_peers_port_1": "2222",
+		"labels_env_0":           "prod",
+	}
+
+	for k, tV := range testTable {
+		if v, ok := kv.Lookup(k); ok == false {
+			t.Errorf("kv.Lookup(%q) = _, false; wanted _, true", k)
+		} else if v != tV {
+			t.Errorf("kv.Lookup(%q) = %q, _; wanted %q, _", k, v, tV)
+		}
+	}
+
+	if len(*kv) != len(testTable) {
+		t.Errorf("len(kv) = %d; wanted %d: %v", len(*kv), len(testTable), *kv)
+	}
+
+	delete(*kv, "servers_1_peers_port_0")
+
+	ts2 := TestStruct{Primary: &TestDB{}}
+
+	if err := o.Import(kv, &ts2); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(ts2, ts) {
+		t.Errorf("Import() = %+v; wanted %+v", ts2, ts)
+	}
+}
@@ -0,0 +1,71 @@
+package kvconfig
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImportPointerFields(t *testing.T) {
+	type TestDatabase struct {
+		Host string `kvconfig:"host"`
+		Port int    `kvconfig:"port,default=5432"`
+	}
+
+	type TestStruct struct {
+		Primary  *TestDatabase  `kvconfig:"primary"`
+		Replica  **TestDatabase `kvconfig:"replica"`
+		Fallback *TestDatabase  `kvconfig:"fallback"`
+		Tags     *[]string      `kvconfig:"tags"`
+	}
+
+	o := Options{PathKeys: true}
+	kv := &MapStrStr{
+		"primary_host_0": "a",
+		"replica_port_0": "6543",
+		"tags_0":         "x",
+		"tags_1":         "y",
+	}
+
+	var ts TestStruct
+	if err := o.Import(kv, &ts); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if ts.Primary == nil || *ts.Primary != (TestDatabase{"a", 5432}) {
+		t.Errorf("Primary = %+v; wanted {a 5432}", ts.Primary)
+	}
+	if ts.Replica == nil || *ts.Replica == nil || **ts.Replica != (TestDatabase{"", 6543}) {
+		t.Errorf("Replica = %v; wanted {'' 6543}", ts.Replica)
+	}
+	// only defaults, which don't count as present keys
+	if ts.Fallback != nil {
+		t.Errorf("Fallback = %+v; wanted nil", ts.Fallback)
+	}
+	if ts.Tags == nil || !reflect.DeepEqual(*ts.Tags, []string{"x", "y"}) {
+		t.Errorf("Tags = %v; wanted [x y]", ts.Tags)
+	}
+}
+
+func TestImportPointerRoundTrip(t *testing.T) {
+	type TestDatabase struct {
+		Host string `kvconfig:"host"`
+	}
+
+	type TestStruct struct {
+		Primary *TestDatabase
+		Backups []TestDatabase
+	}
+
+	ts := TestStruct{Primary: &TestDatabase{"a"}, Backups: []TestDatabase{{"b"}, {"c"}}}
+	kv := &MapStrStr{}
+	if err := Export(&ts, kv); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	var got TestStruct
+	if err := Import(kv, &got); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, ts) {
+		t.Errorf("Import() = %+v; wanted %+v", got, ts)
+	}
+}
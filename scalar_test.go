@@ -0,0 +1,174 @@
+package kvconfig
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScalarRoundTrip(t *testing.T) {
+	type TestStruct struct {
+		TestBool    bool       `kvconfig:"test_bool"`
+		TestInt8    int8       `kvconfig:"test_int8"`
+		TestInt64   int64      `kvconfig:"test_int64"`
+		TestUint16  uint16     `kvconfig:"test_uint16"`
+		TestUint64  uint64     `kvconfig:"test_uint64"`
+		TestFloat32 float32    `kvconfig:"test_float32"`
+		TestFloat64 float64    `kvconfig:"test_float64"`
+		TestComplex complex128 `kvconfig:"test_complex"`
+		TestPtrBool *bool      `kvconfig:"test_ptr_bool"`
+		TestPtrUint *uint      `kvconfig:"test_ptr_uint"`
+	}
+
+	testBool := true
+	testUint := uint(7)
+
+	ts := TestStruct{
+		TestBool:    true,
+		TestInt8:    -128,
+		TestInt64:   1 << 40,
+		TestUint16:  65535,
+		TestUint64:  1<<64 - 1,
+		TestFloat32: 0.1,
+		TestFloat64: 0.25,
+		TestComplex: complex(1, -2),
+		TestPtrBool: &testBool,
+		TestPtrUint: &testUint,
+	}
+
+	kv := NewMap()
+
+	Export(&ts, kv)
+
+	testTable := map[string]string{
+		"test_bool_0":     "true",
+		"test_int8_0":     "-128",
+		"test_int64_0":    "1099511627776",
+		"test_uint16_0":   "65535",
+		"test_uint64_0":   "18446744073709551615",
+		"test_float32_0":  "0.1",
+		"test_float64_0":  "0.25",
+		"test_complex_0":  "(1-2i)",
+		"test_ptr_bool_0": "true",
+		"test_ptr_uint_0": "7",
+	}
+
+	for k, tV := range testTable {
+		if v, ok := kv.Lookup(k); ok == false {
+			t.Errorf("kv.Lookup(%q) = _, false; wanted _, true", k)
+		} else if v != tV {
+			t.Errorf("kv.Lookup(%q) = %q, _; wanted %q, _", k, v, tV)
+		}
+	}
+
+	ts2 := TestStruct{}
+
+	if err := Import(kv, &ts2); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	if ts2.TestPtrBool == nil || ts2.TestPtrUint == nil {
+		t.Fatalf("TestStruct pointers not allocated: %+v", ts2)
+	}
+
+	if *ts2.TestPtrBool != *ts.TestPtrBool || *ts2.TestPtrUint != *ts.TestPtrUint {
+		t.Errorf("TestStruct pointers = %v, %v; wanted %v, %v", *ts2.TestPtrBool, *ts2.TestPtrUint, *ts.TestPtrBool, *ts.TestPtrUint)
+	}
+
+	ts2.TestPtrBool, ts2.TestPtrUint = ts.TestPtrBool, ts.TestPtrUint
+
+	if ts2 != ts {
+		t.Errorf("Import(Export(%+v)) = %+v", ts, ts2)
+	}
+}
+
+func TestScalarRangeErrors(t *testing.T) {
+	type TestStruct struct {
+		TestUint16 uint16 `kvconfig:"test_uint16"`
+		TestInt8   int8   `kvconfig:"test_int8"`
+		TestBool   bool   `kvconfig:"test_bool"`
+	}
+
+	kv := &MapStrStr{
+		"test_uint16_0": "70000",
+		"test_int8_0":   "-129",
+		"test_bool_0":   "yes",
+	}
+
+	ts := TestStruct{}
+
+	errs, ok := Import(kv, &ts).(Errors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("Import() error = %v; wanted 3 Errors", errs)
+	}
+
+	if ts != (TestStruct{}) {
+		t.Errorf("TestStruct = %+v; wanted zero value", ts)
+	}
+}
+
+func TestTimeRoundTrip(t *testing.T) {
+	type TestStruct struct {
+		TestDuration    time.Duration  `kvconfig:"test_duration"`
+		TestTime        time.Time      `kvconfig:"test_time"`
+		TestNanoTime    time.Time      `kvconfig:"test_nano_time"`
+		TestDate        time.Time      `kvconfig:"test_date,layout=dateonly"`
+		TestStamp       time.Time      `kvconfig:"test_stamp,layout=2006-01-02 15:04"`
+		TestPtrDuration *time.Duration `kvconfig:"test_ptr_duration"`
+	}
+
+	testDuration := 90 * time.Minute
+
+	ts := TestStruct{
+		TestDuration:    30 * time.Second,
+		TestTime:        time.Date(2017, 3, 3, 6, 59, 49, 0, time.UTC),
+		TestNanoTime:    time.Date(2017, 3, 3, 6, 59, 49, 123456789, time.UTC),
+		TestDate:        time.Date(2017, 3, 4, 0, 0, 0, 0, time.UTC),
+		TestStamp:       time.Date(2017, 3, 5, 12, 30, 0, 0, time.UTC),
+		TestPtrDuration: &testDuration,
+	}
+
+	kv := NewMap()
+
+	Export(&ts, kv)
+
+	testTable := map[string]string{
+		"test_duration_0":     "30s",
+		"test_time_0":         "2017-03-03T06:59:49Z",
+		"test_nano_time_0":    "2017-03-03T06:59:49.123456789Z",
+		"test_date_0":         "2017-03-04",
+		"test_stamp_0":        "2017-03-05 12:30",
+		"test_ptr_duration_0": "1h30m0s",
+	}
+
+	for k, tV := range testTable {
+		if v, ok := kv.Lookup(k); ok == false {
+			t.Errorf("kv.Lookup(%q) = _, false; wanted _, true", k)
+		} else if v != tV {
+			t.Errorf("kv.Lookup(%q) = %q, _; wanted %q, _", k, v, tV)
+		}
+	}
+
+	ts2 := TestStruct{}
+
+	if err := Import(kv, &ts2); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	if ts2.TestDuration != ts.TestDuration {
+		t.Errorf("TestStruct.TestDuration = %v; wanted %v", ts2.TestDuration, ts.TestDuration)
+	}
+
+	if !ts2.TestNanoTime.Equal(ts.TestNanoTime) {
+		t.Errorf("TestStruct.TestNanoTime = %v; wanted %v", ts2.TestNanoTime, ts.TestNanoTime)
+	}
+
+	if !ts2.TestTime.Equal(ts.TestTime) || !ts2.TestDate.Equal(ts.TestDate) || !ts2.TestStamp.Equal(ts.TestStamp) {
+		t.Errorf("TestStruct times = %v, %v, %v; wanted %v, %v, %v", ts2.TestTime, ts2.TestDate, ts2.TestStamp, ts.TestTime, ts.TestDate, ts.TestStamp)
+	}
+
+	if ts2.TestPtrDuration == nil {
+		t.Error("TestStruct.TestPtrDuration == nil")
+	} else if *ts2.TestPtrDuration != testDuration {
+		t.Errorf("*(TestStruct.TestPtrDuration) = %v; wanted %v", *ts2.TestPtrDuration, testDuration)
+	}
+}
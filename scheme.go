@@ -0,0 +1,85 @@
+package kvconfig
+
+import (
+	"strconv"
+	"strings"
+)
+
+// KeySegment is a step of the path to a value in a structure: the tag of a field,
+// the key of a map entry, the index of a slice element or one part of a value
+// stored across several keys (e.g. "cert" of a TLS certificate).
+type KeySegment struct {
+	Name    string
+	Index   int
+	IsIndex bool
+}
+
+func (seg KeySegment) String() string {
+	if seg.IsIndex {
+		return strconv.Itoa(seg.Index)
+	}
+	return seg.Name
+}
+
+// KeyScheme derives key names from the paths to values (see Options.Scheme).
+// Tags of untagged fields don't appear in paths.
+type KeyScheme interface {
+	Key(path []KeySegment) string
+}
+
+// PathScheme joins paths with underscores, moving the index of the innermost
+// slice element (or 0) to the end, e.g. "servers_1_peers_addr_2" for Servers[1].Peers[2].Addr.
+type PathScheme struct{}
+
+func (PathScheme) Key(path []KeySegment) string {
+	last := -1
+	for i, seg := range path {
+		if seg.IsIndex {
+			last = i
+		}
+	}
+	parts := make([]string, 0, len(path)+1)
+	for i, seg := range path {
+		if i != last {
+			parts = append(parts, seg.String())
+		}
+	}
+	if last == -1 {
+		parts = append(parts, "0")
+	} else {
+		parts = append(parts, path[last].String())
+	}
+	return strings.Join(parts, "_")
+}
+
+// DottedScheme joins paths with Separator, or "." if empty, for hierarchical
+// stores, e.g. "servers.1.peers.2.addr" for Servers[1].Peers[2].Addr or "tls.cert".
+type DottedScheme struct {
+	Separator string
+}
+
+func (d DottedScheme) Key(path []KeySegment) string {
+	parts := make([]string, len(path))
+	for i, seg := range path {
+		parts[i] = seg.String()
+	}
+	return strings.Join(parts, d.separator())
+}
+
+func (d DottedScheme) separator() string {
+	if d.Separator == "" {
+		return "."
+	}
+	return d.Separator
+}
+
+// Returns the key scheme, or nil for counting structures of each type
+func (o *Options) scheme() KeyScheme {
+	if o.Scheme != nil {
+		return o.Scheme
+	}
+	if o.PathKeys {
+		return PathScheme{}
+	}
+	return nil
+}
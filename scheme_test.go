@@ -0,0 +1,178 @@
+package kvconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDottedScheme(t *testing.T) {
+	type TestServer struct {
+		Host  string   `kvconfig:"host"`
+		Ports []int    `kvconfig:"ports"`
+		Tags  []string `kvconfig:"tags,delim"`
+	}
+
+	type TestStruct struct {
+		Name    string            `kvconfig:"name"`
+		TLS     *tls.Certificate  `kvconfig:"tls"`
+		Servers []*TestServer     `kvconfig:"servers"`
+		Labels  map[string]string `kvconfig:"labels"`
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := TestStruct{
+		Name: "test",
+		TLS:  &tls.Certificate{Certificate: [][]byte{testCertificate(t, key)}, PrivateKey: key},
+		Servers: []*TestServer{
+			{Host: "a", Ports: []int{80, 443}},
+			{Host: "b", Tags: []string{"x", "y"}},
+		},
+		Labels: map[string]string{"env": "prod", "team.name": "core"},
+	}
+
+	o := Options{Scheme: DottedScheme{}}
+
+	kv := NewMap()
+
+	if err := o.Export(&ts, kv); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	testTable := map[string]string{
+		"name":              "test",
+		"servers.0.host":    "a",
+		"servers.0.ports.0": "80",
+		"servers.0.ports.1": "443",
+		"servers.1.host":    "b",
+		"servers.1.tags":    "x,y",
+		"labels.env":        "prod",
+		"labels.team.name":  "core",
+	}
+
+	for k, tV := range testTable {
+		if v, ok := kv.Lookup(k); ok == false {
+			t.Errorf("kv.Lookup(%q) = _, false; wanted _, true", k)
+		} else if v != tV {
+			t.Errorf("kv.Lookup(%q) = %q, _; wanted %q, _", k, v, tV)
+		}
+	}
+
+	for _, k := range []string{"tls.cert", "tls.pk"} {
+		if _, ok := kv.Lookup(k); !ok {
+			t.Errorf("kv.Lookup(%q) = _, false; wanted _, true", k)
+		}
+	}
+
+	if len(*kv) != len(testTable)+2 {
+		t.Errorf("len(kv) = %d; wanted %d: %v", len(*kv), len(testTable)+2, *kv)
+	}
+
+	ts2 := TestStruct{}
+
+	if err := o.Import(kv, &ts2); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	ts.TLS.Leaf = ts2.TLS.Leaf
+
+	if !reflect.DeepEqual(ts2, ts) {
+		t.Errorf("Import() = %+v; wanted %+v", ts2, ts)
+	}
+}
+
+func TestPathScheme(t *testing.T) {
+	testTable := []struct {
+		path []KeySegment
+		key  string
+	}{
+		{[]KeySegment{{Name: "port"}}, "port_0"},
+		{[]KeySegment{{Name: "servers"}, {Index: 1, IsIndex: true}, {Name: "host"}}, "servers_host_1"},
+		{[]KeySegment{{Name: "servers"}, {Index: 1, IsIndex: true}, {Name: "peers"}, {Index: 2, IsIndex: true}}, "servers_1_peers_2"},
+		{[]KeySegment{{Name: "tls"}, {Name: "cert"}}, "tls_cert_0"},
+	}
+
+	for _, tE := range testTable {
+		if key := (PathScheme{}).Key(tE.path); key != tE.key {
+			t.Errorf("PathScheme.Key(%v) = %q; wanted %q", tE.path, key, tE.key)
+		}
+	}
+
+	if key := (DottedScheme{Separator: "/"}).Key(testTable[2].path); key != "servers/1/peers/2" {
+		t.Errorf("DottedScheme.Key(%v) = %q; wanted %q", testTable[2].path, key, "servers/1/peers/2")
+	}
+}
+
+func TestParseArgsEnvScheme(t *testing.T) {
+	args := os.Args
+	defer func() { os.Args = args }()
+
+	os.Args = []string{"test", "--servers.1.host", "a", "--log-level=debug"}
+	os.Setenv("CFG_SERVERS__0__HOST", "b")
+	defer os.Unsetenv("CFG_SERVERS__0__HOST")
+
+	testTable := []struct {
+		o    Options
+		keys map[string]string
+	}{
+		{Options{}, map[string]string{"servers.1.host_0": "a", "log_level_0": "debug", "servers__0__host_0": "b"}},
+		{Options{Scheme: DottedScheme{}}, map[string]string{"servers.1.host": "a", "log_level": "debug", "servers.0.host": "b"}},
+	}
+
+	for _, tE := range testTable {
+		kv := NewMap()
+		if err := tE.o.ParseArgs(kv); err != nil {
+			t.Fatalf("ParseArgs() error = %v", err)
+		}
+		tE.o.ParseEnv(kv)
+
+		for k, tV := range tE.keys {
+			if v, ok := kv.Lookup(k); !ok || v != tV {
+				t.Errorf("kv.Lookup(%q) = %q, %v; wanted %q, true", k, v, ok, tV)
+			}
+		}
+	}
+}
+
+func TestDottedSliceOfMaps(t *testing.T) {
+	type TestStruct struct {
+		Attrs []map[string]string `kvconfig:"a"`
+	}
+
+	ts := TestStruct{Attrs: []map[string]string{{"k": "x"}, {"k": "y", "j": "z"}}}
+
+	testTable := []struct {
+		o    Options
+		keys MapStrStr
+	}{
+		{Options{}, MapStrStr{"a_k_0": "x", "a_k_1": "y", "a_j_1": "z"}},
+		{Options{PathKeys: true}, MapStrStr{"a_k_0": "x", "a_k_1": "y", "a_j_1": "z"}},
+		{Options{Scheme: DottedScheme{}}, MapStrStr{"a.0.k": "x", "a.1.k": "y", "a.1.j": "z"}},
+	}
+
+	for _, tE := range testTable {
+		kv := NewMap()
+		if err := tE.o.Export(&ts, kv); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if !reflect.DeepEqual(*kv, tE.keys) {
+			t.Errorf("%+v: Export() = %v; wanted %v", tE.o, *kv, tE.keys)
+		}
+
+		ts2 := TestStruct{}
+		if err := tE.o.Import(kv, &ts2); err != nil {
+			t.Fatalf("Import() error = %v", err)
+		}
+		if !reflect.DeepEqual(ts2, ts) {
+			t.Errorf("%+v: Import() = %+v; wanted %+v", tE.o, ts2, ts)
+		}
+	}
+}
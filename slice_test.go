@@ -0,0 +1,284 @@
+package kvconfig
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSliceRoundTrip(t *testing.T) {
+	type TestSubStruct struct {
+		TestSubInt int `kvconfig:"test_sub_int"`
+	}
+
+	type TestStruct struct {
+		TestHosts    []string        `kvconfig:"test_host"`
+		TestPorts    []*int          `kvconfig:"test_port"`
+		TestLevels   []testLevel     `kvconfig:"test_level"`
+		TestTimeouts []time.Duration `kvconfig:"test_timeouts,delim"`
+		TestTags     []string        `kvconfig:"test_tags,delim=;"`
+		TestEmpty    []string        `kvconfig:"test_empty,delim"`
+		SubStructs   []TestSubStruct
+	}
+
+	port := 443
+	ts := TestStruct{
+		TestHosts:    []string{"a.example.com", "b.example.com", ""},
+		TestPorts:    []*int{&port},
+		TestLevels:   []testLevel{1, 0},
+		TestTimeouts: []time.Duration{time.Second, time.Minute},
+		TestTags:     []string{"x,y", "z"},
+		SubStructs:   []TestSubStruct{{1}, {2}},
+	}
+
+	kv := NewMap()
+
+	if err := Export(&ts, kv); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	testTable := map[string]string{
+		"test_host_0":     "a.example.com",
+		"test_host_1":     "b.example.com",
+		"test_host_2":     "",
+		"test_port_0":     "443",
+		"test_level_0":    "debug",
+		"test_level_1":    "info",
+		"test_timeouts_0": "1s,1m0s",
+		"test_tags_0":     "x,y;z",
+		"test_sub_int_0":  "1",
+		"test_sub_int_1":  "2",
+	}
+
+	for k, tV := range testTable {
+		if v, ok := kv.Lookup(k); ok == false {
+			t.Errorf("kv.Lookup(%q) = _, false; wanted _, true", k)
+		} else if v != tV {
+			t.Errorf("kv.Lookup(%q) = %q, _; wanted %q, _", k, v, tV)
+		}
+	}
+
+	if len(*kv) != len(testTable) {
+		t.Errorf("len(kv) = %d; wanted %d: %v", len(*kv), len(testTable), *kv)
+	}
+
+	kv.Set("test_tags_0", " x ; y,z ")
+	kv.Set("test_empty_0", "")
+
+	ts2 := TestStruct{TestTags: []string{"old"}}
+
+	if err := Import(kv, &ts2); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(ts2.TestHosts, ts.TestHosts) {
+		t.Errorf("TestStruct.TestHosts = %q; wanted %q", ts2.TestHosts, ts.TestHosts)
+	}
+
+	if len(ts2.TestPorts) != 1 || ts2.TestPorts[0] == nil || *ts2.TestPorts[0] != port {
+		t.Errorf("TestStruct.TestPorts = %v; wanted pointer to %d", ts2.TestPorts, port)
+	}
+
+	if !reflect.DeepEqual(ts2.TestLevels, ts.TestLevels) {
+		t.Errorf("TestStruct.TestLevels = %v; wanted %v", ts2.TestLevels, ts.TestLevels)
+	}
+
+	if !reflect.DeepEqual(ts2.TestTimeouts, ts.TestTimeouts) {
+		t.Errorf("TestStruct.TestTimeouts = %v; wanted %v", ts2.TestTimeouts, ts.TestTimeouts)
+	}
+
+	if tags := []string{"x", "y,z"}; !reflect.DeepEqual(ts2.TestTags, tags) {
+		t.Errorf("TestStruct.TestTags = %q; wanted %q", ts2.TestTags, tags)
+	}
+
+	if ts2.TestEmpty == nil || len(ts2.TestEmpty) != 0 {
+		t.Errorf("TestStruct.TestEmpty = %#v; wanted empty slice", ts2.TestEmpty)
+	}
+
+	if !reflect.DeepEqual(ts2.SubStructs, ts.SubStructs) {
+		t.Errorf("TestStruct.SubStructs = %v; wanted %v", ts2.SubStructs, ts.SubStructs)
+	}
+}
+
+func TestSliceImportErrors(t *testing.T) {
+	type TestStruct struct {
+		TestPorts []int `kvconfig:"test_port"`
+		TestIDs   []int `kvconfig:"test_ids,delim"`
+	}
+
+	ts := TestStruct{TestIDs: []int{7}}
+
+	kv := &MapStrStr{
+		"test_port_0": "80",
+		"test_port_1": "x",
+		"test_port_2": "8080",
+		"test_ids_0":  "1,y",
+	}
+
+	errs, ok := Import(kv, &ts).(Errors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("Import() error = %v; wanted 2 Errors", errs)
+	}
+
+	testTable := []KeyError{
+		{Key: "test_port_1", Field: "TestStruct.TestPorts[1]", Value: "x"},
+		{Key: "test_ids_0", Field: "TestStruct.TestIDs[1]", Value: "y"},
+	}
+
+	for i, tE := range testTable {
+		if errs[i].Key != tE.Key || errs[i].Field != tE.Field || errs[i].Value != tE.Value {
+			t.Errorf("Errors[%d] = %+v; wanted %+v", i, *errs[i], tE)
+		}
+	}
+
+	if ports := []int{80, 0, 8080}; !reflect.DeepEqual(ts.TestPorts, ports) {
+		t.Errorf("TestStruct.TestPorts = %v; wanted %v", ts.TestPorts, ports)
+	}
+
+	if ids := []int{7}; !reflect.DeepEqual(ts.TestIDs, ids) {
+		t.Errorf("TestStruct.TestIDs = %v; wanted %v", ts.TestIDs, ids)
+	}
+}
+
+func TestArrayRoundTrip(t *testing.T) {
+	type TestPeer struct {
+		Addr string `kvconfig:"addr"`
+	}
+
+	type TestStruct struct {
+		TestHosts [3]string    `kvconfig:"test_host"`
+		TestTags  [2]string    `kvconfig:"test_tags,delim"`
+		Peers     [2]*TestPeer `kvconfig:"peers"`
+	}
+
+	for _, o := range []Options{{}, {PathKeys: true}} {
+		ts := TestStruct{
+			TestHosts: [3]string{"a", "b"},
+			TestTags:  [2]string{"x", "y"},
+			Peers:     [2]*TestPeer{{"c"}, {"d"}},
+		}
+		kv := &MapStrStr{}
+		if err := o.Export(&ts, kv); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if got := kv.Get("test_host_1"); got != "b" {
+			t.Errorf("test_host_1 = %q; wanted b", got)
+		}
+
+		var ts2 TestStruct
+		if err := o.Import(kv, &ts2); err != nil {
+			t.Fatalf("Import() error = %v", err)
+		}
+		if !reflect.DeepEqual(ts, ts2) {
+			t.Errorf("Import() = %+v; wanted %+v", ts2, ts)
+		}
+	}
+
+	kv := &MapStrStr{"test_host_3": "d", "test_tags_0": "x,y,z"}
+	err := Import(kv, &TestStruct{})
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("Import() error = %v; wanted 2 errors", err)
+	}
+	for i, key := range []string{"test_host_3", "test_tags_0"} {
+		if errs[i].Key != key || errs[i].Err != ErrArrayOverflow {
+			t.Errorf("Errors[%d] = %v; wanted %v for %s", i, errs[i], ErrArrayOverflow, key)
+		}
+	}
+	if errs[0].Field != "TestStruct.TestHosts[3]" {
+		t.Errorf("Errors[0].Field = %q; wanted TestStruct.TestHosts[3]", errs[0].Field)
+	}
+}
+
+func TestNestedSlices(t *testing.T) {
+	type TestStruct struct {
+		Groups [][]string  `kvconfig:"groups"`
+		Grid   [][2]int    `kvconfig:"grid"`
+		Hosts  []string    `kvconfig:"hosts"`
+		Matrix [2][]string `kvconfig:"matrix"`
+	}
+
+	ts := TestStruct{
+		Groups: [][]string{{"a", "b"}, {"c"}},
+		Grid:   [][2]int{{1, 2}, {3, 4}},
+		Hosts:  []string{"d"},
+		Matrix: [2][]string{nil, {"e"}},
+	}
+
+	testTable := []struct {
+		o    Options
+		keys map[string]string
+	}{
+		{Options{}, map[string]string{"groups_0_1": "b", "groups_1_0": "c", "grid_1_0": "3", "hosts_0": "d", "matrix_1_0": "e"}},
+		{Options{PathKeys: true}, map[string]string{"groups_0_1": "b", "groups_1_0": "c", "grid_1_0": "3", "hosts_0": "d", "matrix_1_0": "e"}},
+		{Options{Scheme: DottedScheme{}}, map[string]string{"groups.0.1": "b", "groups.1.0": "c", "grid.1.0": "3", "hosts.0": "d", "matrix.1.0": "e"}},
+	}
+
+	for _, tt := range testTable {
+		kv := &MapStrStr{}
+		if err := tt.o.Export(&ts, kv); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		for k, v := range tt.keys {
+			if got, ok := kv.Lookup(k); !ok || got != v {
+				t.Errorf("%+v: %s = %q; wanted %q in %v", tt.o, k, got, v, kv)
+			}
+		}
+
+		var ts2 TestStruct
+		if err := tt.o.Import(kv, &ts2); err != nil {
+			t.Fatalf("Import() error = %v", err)
+		}
+		if !reflect.DeepEqual(ts, ts2) {
+			t.Errorf("%+v: Import() = %+v; wanted %+v", tt.o, ts2, ts)
+		}
+	}
+}
+
+func TestNestedSliceFieldRoundTrip(t *testing.T) {
+	type TestServer struct {
+		Name  string   `kvconfig:"name"`
+		Hosts []string `kvconfig:"host"`
+	}
+
+	type TestStruct struct {
+		Servers []TestServer
+		Hosts   []string `kvconfig:"host"`
+	}
+
+	ts := TestStruct{
+		Servers: []TestServer{{"a", []string{"h1", "h2"}}, {"b", []string{"h3"}}, {"c", nil}},
+		Hosts:   []string{"h4"},
+	}
+
+	kv := &MapStrStr{}
+	if err := Export(&ts, kv); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	want := MapStrStr{
+		"name_0": "a", "host_0_0": "h1", "host_0_1": "h2",
+		"name_1": "b", "host_1_0": "h3",
+		"name_2": "c",
+		"host_0": "h4",
+	}
+	if !reflect.DeepEqual(*kv, want) {
+		t.Errorf("Export() = %v; wanted %v", *kv, want)
+	}
+
+	var ts2 TestStruct
+	if err := Import(kv, &ts2); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if !reflect.DeepEqual(ts, ts2) {
+		t.Errorf("Import() = %+v; wanted %+v", ts2, ts)
+	}
+
+	// a structure whose only keys are its slice field's elements
+	ts2 = TestStruct{}
+	if err := Import(&MapStrStr{"host_0_0": "h1", "host_1_0": "h2"}, &ts2); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if len(ts2.Servers) != 2 || ts2.Servers[1].Hosts[0] != "h2" {
+		t.Errorf("Import() = %+v; wanted 2 servers", ts2)
+	}
+}
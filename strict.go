@@ -0,0 +1,92 @@
+package kvconfig
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// UnknownKeyError is the cause of a KeyError for a key no field imported, when importing strictly.
+type UnknownKeyError struct {
+	Suggestion string // closest key the walk looked for, if any was close enough
+}
+
+func (e *UnknownKeyError) Error() string {
+	if e.Suggestion == "" {
+		return "unknown key"
+	}
+	return fmt.Sprintf("unknown key, did you mean %q?", e.Suggestion)
+}
+
+var errNotRanger = errors.New("kvconfig: strict import requires a key/value store implementing Ranger")
+
+// ImportStrict is like Import but also reports keys in kv that no field imported,
+// such as misspelt keys. kv must implement Ranger.
+func ImportStrict(kv Getter, i interface{}) error {
+	return Options{Strict: true}.Import(kv, i)
+}
+
+// Reports the keys of kv that weren't looked up, suggesting the closest key that
+// was, preferring those that were absent (e.g. "host_2" over "host_0").
+// used maps the keys looked up to whether they were found.
+func (s *walkState) unknownKeys(kv Ranger, used map[string]bool) {
+	known := make([]string, 0, len(used))
+	for k := range used {
+		known = append(known, k)
+	}
+	sort.Slice(known, func(i, j int) bool {
+		if used[known[i]] != used[known[j]] {
+			return !used[known[i]]
+		}
+		return known[i] < known[j]
+	})
+
+	kv.Range("", func(k, v string) bool {
+		if _, ok := used[k]; !ok {
+			s.errs = append(s.errs, &KeyError{Key: k, Value: v, Err: &UnknownKeyError{suggest(k, known)}})
+		}
+		return true
+	})
+}
+
+// Returns the first of known within an edit distance of a third of the length of k
+func suggest(k string, known []string) string {
+	best, bestDist := "", len(k)/3+1
+	for _, kn := range known {
+		if d := editDistance(k, kn); d < bestDist {
+			best, bestDist = kn, d
+		}
+	}
+	return best
+}
+
+// Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
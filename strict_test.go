@@ -0,0 +1,80 @@
+package kvconfig
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestImportStrict(t *testing.T) {
+	type TestStruct struct {
+		ListenAddress string            `kvconfig:"listen_address"`
+		Hosts         []string          `kvconfig:"host"`
+		Labels        map[string]string `kvconfig:"labels"`
+	}
+
+	kv := &MapStrStr{
+		"listen_adress_0": ":8080",
+		"host_0":          "a",
+		"host_1":          "b",
+		"host_3":          "d",
+		"labels_env_0":    "prod",
+		"unrelated_0":     "x",
+	}
+
+	ts := TestStruct{}
+
+	errs, ok := ImportStrict(kv, &ts).(Errors)
+	if !ok {
+		t.Fatalf("ImportStrict() error = %v; wanted Errors", errs)
+	}
+
+	testTable := []struct {
+		key        string
+		suggestion string
+	}{
+		{"host_3", "host_2"},
+		{"listen_adress_0", "listen_address_0"},
+		{"unrelated_0", ""},
+	}
+
+	if len(errs) != len(testTable) {
+		t.Fatalf("len(Errors) = %d; wanted %d: %v", len(errs), len(testTable), errs)
+	}
+
+	for i, tE := range testTable {
+		var uerr *UnknownKeyError
+		if errs[i].Key != tE.key || !errors.As(errs[i], &uerr) || uerr.Suggestion != tE.suggestion {
+			t.Errorf("Errors[%d] = %v; wanted unknown key %q suggesting %q", i, errs[i], tE.key, tE.suggestion)
+		}
+	}
+
+	if len(ts.Hosts) != 2 || ts.Labels["env"] != "prod" {
+		t.Errorf("ImportStrict() = %+v; wanted known keys imported", ts)
+	}
+
+	delete(*kv, "listen_adress_0")
+	delete(*kv, "host_3")
+	delete(*kv, "unrelated_0")
+
+	if err := ImportStrict(kv, &ts); err != nil {
+		t.Errorf("ImportStrict() error = %v; wanted nil", err)
+	}
+
+	if err := ImportStrict(testGetter{*kv}, &ts); err != errNotRanger {
+		t.Errorf("ImportStrict() error = %v; wanted %v", err, errNotRanger)
+	}
+}
+
+// Store implementing only Getter
+type testGetter struct {
+	m MapStrStr
+}
+
+func (g testGetter) Get(k string) string {
+	return g.m[k]
+}
+
+func (g testGetter) Lookup(k string) (string, bool) {
+	v, ok := g.m[k]
+	return v, ok
+}
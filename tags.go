@@ -0,0 +1,73 @@
+package kvconfig
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Options following the key name in a field tag, e.g. `kvconfig:"start,layout=2006-01-02"`.
+// Flag options without a value map to "".
+type tagOptions map[string]string
+
+// Splits a field tag into its key name and options.
+// A comma may be used in an option value by escaping it with a backslash.
+func parseTag(tag string) (string, tagOptions) {
+	parts := splitEscaped(tag, ',')
+	opts := make(tagOptions)
+	for _, part := range parts[1:] {
+		if part == "" {
+			continue
+		}
+		if eqPos := strings.Index(part, "="); eqPos != -1 {
+			opts[part[:eqPos]] = part[eqPos+1:]
+		} else {
+			opts[part] = ""
+		}
+	}
+	return parts[0], opts
+}
+
+func splitEscaped(s string, sep byte) []string {
+	var parts []string
+	var cur []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && s[i+1] == sep {
+			cur = append(cur, sep)
+			i++
+		} else if s[i] == sep {
+			parts = append(parts, string(cur))
+			cur = cur[:0]
+		} else {
+			cur = append(cur, s[i])
+		}
+	}
+	return append(parts, string(cur))
+}
+
+func (o tagOptions) Has(name string) bool {
+	_, ok := o[name]
+	return ok
+}
+
+func (o tagOptions) Get(name string) (string, bool) {
+	v, ok := o[name]
+	return v, ok
+}
+
+// Converts a Go identifier to snake_case, keeping acronyms together,
+// e.g. "TLSCert" to "tls_cert" and "MaxIdleConns" to "max_idle_conns".
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
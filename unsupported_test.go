@@ -0,0 +1,139 @@
+package kvconfig
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testBackend interface {
+	Addr() string
+}
+
+type testHTTPBackend struct {
+	Host string `kvconfig:"host"`
+	Port int    `kvconfig:"port"`
+}
+
+func (b *testHTTPBackend) Addr() string {
+	return b.Host
+}
+
+func TestUnexportedFields(t *testing.T) {
+	type TestStruct struct {
+		Name   string `kvconfig:"name"`
+		secret string `kvconfig:"secret"`
+		port   *int   `kvconfig:"port"`
+	}
+
+	kv := MapStrStr{"name_0": "a", "secret_0": "s", "port_0": "1"}
+	var ts TestStruct
+	if err := Import(&kv, &ts); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if ts.Name != "a" || ts.secret != "" || ts.port != nil {
+		t.Errorf("Import = %+v, wanted only Name set", ts)
+	}
+
+	out := MapStrStr{}
+	if err := Export(&TestStruct{Name: "a", secret: "s"}, &out); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if !reflect.DeepEqual(out, MapStrStr{"name_0": "a"}) {
+		t.Errorf("Export = %v", out)
+	}
+}
+
+func TestUnsupportedTypes(t *testing.T) {
+	type TestStruct struct {
+		Events  chan int    `kvconfig:"events"`
+		Hook    func()      `kvconfig:"hook"`
+		Backend testBackend `kvconfig:"backend"`
+		Any     interface{} `kvconfig:"any"`
+	}
+
+	// only the fields whose keys are present are reported
+	var ts TestStruct
+	err := Import(&MapStrStr{"hook_0": "x", "backend_0": "x", "any_0": "5"}, &ts)
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 3 {
+		t.Fatalf("Import: %v, wanted 3 errors", err)
+	}
+	for i, key := range []string{"hook_0", "backend_0", "any_0"} {
+		var uerr *UnsupportedTypeError
+		if errs[i].Key != key || !errors.As(errs[i], &uerr) {
+			t.Errorf("errs[%d] = %v, wanted an UnsupportedTypeError for %q", i, errs[i], key)
+		}
+	}
+
+	ts = TestStruct{}
+	if err := Import(&MapStrStr{}, &ts); err != nil {
+		t.Errorf("Import: %v, wanted no errors for absent keys", err)
+	}
+
+	// a non-nil interface is imported as its value's type
+	ts = TestStruct{Any: 0}
+	if err := Import(&MapStrStr{"any_0": "5"}, &ts); err != nil || ts.Any != 5 {
+		t.Errorf("Import: %v, %v; wanted 5", err, ts.Any)
+	}
+
+	if err := Export(&TestStruct{}, &MapStrStr{}); err != nil {
+		t.Errorf("Export: %v, wanted no errors for nil values", err)
+	}
+
+	err = Export(&TestStruct{Events: make(chan int), Hook: func() {}}, &MapStrStr{})
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Errorf("Export: %v, wanted 2 errors", err)
+	}
+}
+
+func TestRegisterImpl(t *testing.T) {
+	type TestStruct struct {
+		Primary  testBackend `kvconfig:"primary"`
+		Fallback testBackend `kvconfig:"fallback"`
+	}
+
+	r := NewRegistry()
+	r.RegisterImpl((*testBackend)(nil), (*testHTTPBackend)(nil))
+	o := Options{Registry: r, Scheme: PathScheme{}}
+
+	ts := TestStruct{Primary: &testHTTPBackend{"a", 80}}
+	kv := MapStrStr{}
+	if err := o.Export(&ts, &kv); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	want := MapStrStr{"primary_host_0": "a", "primary_port_0": "80"}
+	if !reflect.DeepEqual(kv, want) {
+		t.Errorf("Export = %v, wanted %v", kv, want)
+	}
+
+	var got TestStruct
+	if err := o.Import(&kv, &got); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if !reflect.DeepEqual(got, ts) {
+		t.Errorf("Import = %+v, wanted %+v", got, ts)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("RegisterImpl of a non-implementing type didn't panic")
+		}
+	}()
+	r.RegisterImpl((*testBackend)(nil), testHTTPBackend{})
+}
+
+func TestUntaggedInterfaceStrict(t *testing.T) {
+	type TestStruct struct {
+		Name    string `kvconfig:"name"`
+		Backend testBackend
+	}
+
+	// the untagged interface field has no key to look up, so none is suggested
+	err := ImportStrict(&MapStrStr{"name_0": "a", "a_0": "x"}, &TestStruct{})
+	var errs Errors
+	var uerr *UnknownKeyError
+	if !errors.As(err, &errs) || len(errs) != 1 || !errors.As(errs[0], &uerr) || uerr.Suggestion != "" {
+		t.Errorf("ImportStrict: %v, wanted an unknown key a_0 without a suggestion", err)
+	}
+}
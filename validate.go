@@ -0,0 +1,212 @@
+package kvconfig
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validator is implemented by structures checking their fields after being imported,
+// e.g. for constraints between fields. Returning a *KeyError (or Errors) with Field set to
+// the name of one of the structure's fields reports the error against that field's key.
+type Validator interface {
+	Validate() error
+}
+
+// ConstraintError is the cause of a KeyError for a field violating a constraint tag option.
+type ConstraintError struct {
+	Constraint string // tag option, e.g. "min"
+	Param      string // tag option value, e.g. "1"
+	msg        string
+}
+
+func (e *ConstraintError) Error() string {
+	return e.msg
+}
+
+// Tag options checked against a field's value after import
+var constraints = []string{"nonempty", "len", "min", "max", "oneof", "regexp"}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Checks the constraint tag options of f against v.
+// Nil pointers are only checked by "nonempty".
+func validateField(v reflect.Value, f Field) []error {
+	var errs []error
+	for _, c := range constraints {
+		param, ok := f.Option(c)
+		if !ok {
+			continue
+		}
+		if err := checkConstraint(v, c, param); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func checkConstraint(v reflect.Value, c, param string) error {
+	if c == "nonempty" {
+		if !v.IsValid() || v.IsZero() {
+			return &ConstraintError{c, param, "must not be empty"}
+		}
+		return nil
+	}
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch c {
+	case "len":
+		n, err := strconv.Atoi(param)
+		if err != nil {
+			return fmt.Errorf("invalid len option %q: %v", param, err)
+		}
+		l, ok := length(v)
+		if !ok {
+			return fmt.Errorf("len option not supported for %v", v.Type())
+		}
+		if l != n {
+			return &ConstraintError{c, param, fmt.Sprintf("length must be %d, not %d", n, l)}
+		}
+	case "min", "max":
+		cmp, err := compare(v, param)
+		if err != nil {
+			return fmt.Errorf("invalid %s option %q: %v", c, param, err)
+		}
+		_, isLen := length(v)
+		what := "must be"
+		if isLen {
+			what = "length must be"
+		}
+		if c == "min" && cmp < 0 {
+			return &ConstraintError{c, param, fmt.Sprintf("%s at least %s", what, param)}
+		} else if c == "max" && cmp > 0 {
+			return &ConstraintError{c, param, fmt.Sprintf("%s at most %s", what, param)}
+		}
+	case "oneof":
+		str := fmt.Sprint(v.Interface())
+		for _, opt := range strings.Split(param, "|") {
+			if str == opt {
+				return nil
+			}
+		}
+		return &ConstraintError{c, param, fmt.Sprintf("must be one of %s", strings.Replace(param, "|", ", ", -1))}
+	case "regexp":
+		re, err := regexp.Compile(param)
+		if err != nil {
+			return fmt.Errorf("invalid regexp option %q: %v", param, err)
+		}
+		if v.Kind() != reflect.String {
+			return fmt.Errorf("regexp option not supported for %v", v.Type())
+		}
+		if !re.MatchString(v.String()) {
+			return &ConstraintError{c, param, fmt.Sprintf("must match %s", param)}
+		}
+	}
+	return nil
+}
+
+// Length of strings, slices, arrays and maps
+func length(v reflect.Value) (int, bool) {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len(), true
+	}
+	return 0, false
+}
+
+// Compares v (or its length) to param, returning -1, 0 or 1
+func compare(v reflect.Value, param string) (int, error) {
+	if l, ok := length(v); ok {
+		n, err := strconv.Atoi(param)
+		return compareInt64(int64(l), int64(n)), err
+	}
+
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(param)
+		return compareInt64(v.Int(), int64(d)), err
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(param, 10, 64)
+		return compareInt64(v.Int(), n), err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(param, 10, 64)
+		switch {
+		case v.Uint() < n:
+			return -1, err
+		case v.Uint() > n:
+			return 1, err
+		}
+		return 0, err
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(param, 64)
+		switch {
+		case v.Float() < n:
+			return -1, err
+		case v.Float() > n:
+			return 1, err
+		}
+		return 0, err
+	}
+	return 0, fmt.Errorf("not supported for %v", v.Type())
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Calls the Validate method of the structure v, if it has one
+func validateStruct(v reflect.Value, s *importState) {
+	var i interface{}
+	if v.CanAddr() {
+		i = v.Addr().Interface()
+	} else {
+		i = v.Interface()
+	}
+	validator, ok := i.(Validator)
+	if !ok {
+		return
+	}
+
+	var errs Errors
+	switch err := validator.Validate().(type) {
+	case nil:
+		return
+	case Errors:
+		errs = err
+	case *KeyError:
+		errs = Errors{err}
+	default:
+		errs = Errors{&KeyError{Err: err}}
+	}
+
+	for _, kerr := range errs {
+		if kerr.Field == "" {
+			kerr.Field = s.path.String()
+		} else if sf, ok := v.Type().FieldByName(kerr.Field); ok {
+			// errors against a field of the structure
+			sfield := structAndField{structType: v.Type(), field: sf}
+			if f, ok := s.field(&sfield); ok && kerr.Key == "" {
+				kerr.Key = f.Key()
+			}
+			kerr.Field = s.path.String() + "." + kerr.Field
+		}
+		s.errs = append(s.errs, kerr)
+	}
+}
@@ -0,0 +1,81 @@
+package kvconfig
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type testLimits struct {
+	MinConns int `kvconfig:"min_conns"`
+	MaxConns int `kvconfig:"max_conns,min=1,max=100"`
+}
+
+func (l *testLimits) Validate() error {
+	if l.MinConns > l.MaxConns {
+		return &KeyError{Field: "MinConns", Err: errors.New("must not exceed MaxConns")}
+	}
+	return nil
+}
+
+func TestImportValidation(t *testing.T) {
+	type TestStruct struct {
+		TestName    string        `kvconfig:"test_name,nonempty"`
+		TestMode    string        `kvconfig:"test_mode,oneof=dev|prod"`
+		TestCode    string        `kvconfig:"test_code,len=3,regexp=^[A-Z]+$"`
+		TestRatio   float64       `kvconfig:"test_ratio,min=0,max=1"`
+		TestTimeout time.Duration `kvconfig:"test_timeout,min=1s"`
+		TestPtr     *int          `kvconfig:"test_ptr,min=10"`
+		TestOK      uint16        `kvconfig:"test_ok,min=1,max=65535"`
+		Limits      testLimits
+	}
+
+	kv := &MapStrStr{
+		"test_mode_0":    "staging",
+		"test_code_0":    "ab",
+		"test_ratio_0":   "1.5",
+		"test_timeout_0": "500ms",
+		"test_ok_0":      "443",
+		"min_conns_0":    "10",
+		"max_conns_0":    "5",
+	}
+
+	ts := TestStruct{}
+
+	errs, ok := Import(kv, &ts).(Errors)
+	if !ok {
+		t.Fatalf("Import() error = %v; wanted Errors", errs)
+	}
+
+	testTable := []struct {
+		key        string
+		field      string
+		constraint string
+	}{
+		{"test_name_0", "TestStruct.TestName", "nonempty"},
+		{"test_mode_0", "TestStruct.TestMode", "oneof"},
+		{"test_code_0", "TestStruct.TestCode", "len"},
+		{"test_code_0", "TestStruct.TestCode", "regexp"},
+		{"test_ratio_0", "TestStruct.TestRatio", "max"},
+		{"test_timeout_0", "TestStruct.TestTimeout", "min"},
+		{"min_conns_0", "TestStruct.Limits.MinConns", ""},
+	}
+
+	if len(errs) != len(testTable) {
+		t.Fatalf("len(Errors) = %d; wanted %d: %v", len(errs), len(testTable), errs)
+	}
+
+	for i, tE := range testTable {
+		if errs[i].Key != tE.key || errs[i].Field != tE.field {
+			t.Errorf("Errors[%d] = %+v; wanted key %q for %q", i, *errs[i], tE.key, tE.field)
+		}
+		var cerr *ConstraintError
+		if errors.As(errs[i], &cerr) != (tE.constraint != "") || (cerr != nil && cerr.Constraint != tE.constraint) {
+			t.Errorf("Errors[%d].Err = %v; wanted %q constraint", i, errs[i].Err, tE.constraint)
+		}
+	}
+
+	if ts.TestMode != "staging" {
+		t.Errorf("TestStruct.TestMode = %q; wanted %q", ts.TestMode, "staging")
+	}
+}